@@ -1,5 +1,7 @@
 package assets
 
+import "github.com/go-gl/gl/v4.1-core/gl"
+
 var (
 	Textures     = make(map[uint32]Texture)
 	TexturePaths = make(map[string]uint32)
@@ -30,3 +32,18 @@ func GetTextureFromCachePath(path string) (Texture, bool) {
 	tex, ok := Textures[TexturePaths[path]]
 	return tex, ok
 }
+
+// UnloadTextureFromCachePath deletes the GPU texture loaded from the passed path and removes it from the cache.
+// Returns false if the path is not cached
+func UnloadTextureFromCachePath(path string) bool {
+
+	texID, ok := TexturePaths[path]
+	if !ok {
+		return false
+	}
+
+	gl.DeleteTextures(1, &texID)
+	delete(Textures, texID)
+	delete(TexturePaths, path)
+	return true
+}
@@ -2,6 +2,7 @@ package camera
 
 import (
 	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nmage/layers"
 )
 
 type Type int32
@@ -32,6 +33,14 @@ type Camera struct {
 	// Matrices
 	ViewMat gglm.Mat4
 	ProjMat gglm.Mat4
+
+	// CullingMask is the layers this camera renders. See level.Level.ForEachSeenBy
+	CullingMask layers.Mask
+}
+
+// SeesLayers reports whether things on the passed layers should be rendered by this camera
+func (c *Camera) SeesLayers(mask layers.Mask) bool {
+	return c.CullingMask.Intersects(mask)
 }
 
 // Update recalculates view matrix and projection matrix.
@@ -72,6 +81,8 @@ func NewPerspective(pos, forward, worldUp *gglm.Vec3, nearClip, farClip, fovRadi
 
 		Fov:         fovRadians,
 		AspectRatio: aspectRatio,
+
+		CullingMask: layers.Mask_All,
 	}
 	cam.Update()
 
@@ -93,6 +104,8 @@ func NewOrthographic(pos, forward, worldUp *gglm.Vec3, nearClip, farClip, left,
 		Right:  right,
 		Top:    top,
 		Bottom: bottom,
+
+		CullingMask: layers.Mask_All,
 	}
 	cam.Update()
 
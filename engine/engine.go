@@ -3,12 +3,10 @@ package engine
 import (
 	"runtime"
 
-	imgui "github.com/AllenDang/cimgui-go"
 	"github.com/bloeys/nmage/assert"
 	"github.com/bloeys/nmage/input"
 	"github.com/bloeys/nmage/renderer"
 	"github.com/bloeys/nmage/timing"
-	nmageimgui "github.com/bloeys/nmage/ui/imgui"
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/veandco/go-sdl2/sdl"
 )
@@ -18,95 +16,121 @@ var (
 )
 
 type Window struct {
-	SDLWin         *sdl.Window
-	GlCtx          sdl.GLContext
+	SDLWin *sdl.Window
+	GlCtx  sdl.GLContext
+	ID     uint32
+
+	// EventCallbacks get the events for this window, as well as events not for any specific window if this is the main window
 	EventCallbacks []func(sdl.Event)
-	Rend           renderer.Render
+
+	// CloseCallbacks are called when closing the window is requested (e.g. by pressing the X button).
+	// If there are none then the main window requests a quit and other windows are destroyed
+	CloseCallbacks []func(w *Window)
+
+	// RenderCallbacks draw windows other than the main one (which uses Game.Render), and are called every frame after the main window is drawn.
+	// The window is current and cleared before the callbacks are called
+	RenderCallbacks []func(w *Window)
+
+	Rend renderer.Render
+
+	isDestroyed bool
 }
 
+// handleInputs polls all events and routes them to their window.
+// Only events for the main window (or not for any window) go through the event processors
 func (w *Window) handleInputs() {
 
 	input.EventLoopStart()
-	imIo := imgui.CurrentIO()
 
-	// @TODO: Would be nice to have imgui package process its own events via a callback instead of it being part of engine code
 	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 
+		target := w
+		if winID, ok := eventWindowID(event); ok {
+			if tw := GetWindowByID(winID); tw != nil {
+				target = tw
+			}
+		}
+
 		//Fire callbacks
-		for i := 0; i < len(w.EventCallbacks); i++ {
-			w.EventCallbacks[i](event)
+		for i := 0; i < len(target.EventCallbacks); i++ {
+			target.EventCallbacks[i](event)
 		}
 
 		//Internal processing
-		switch e := event.(type) {
+		if we, ok := event.(*sdl.WindowEvent); ok {
 
-		case *sdl.MouseWheelEvent:
-
-			input.HandleMouseWheelEvent(e)
-
-			xDelta, yDelta := input.GetMouseWheelMotion()
-			imIo.AddMouseWheelDelta(float32(xDelta), float32(yDelta))
-
-		case *sdl.KeyboardEvent:
-
-			input.HandleKeyboardEvent(e)
-			imIo.AddKeyEvent(nmageimgui.SdlScancodeToImGuiKey(e.Keysym.Scancode), e.Type == sdl.KEYDOWN)
-
-			// Send modifier key updates to imgui
-			if e.Keysym.Sym == sdl.K_LCTRL || e.Keysym.Sym == sdl.K_RCTRL {
-				imIo.SetKeyCtrl(e.Type == sdl.KEYDOWN)
+			if we.Event == sdl.WINDOWEVENT_CLOSE {
+				target.handleCloseRequest(target == w)
+				continue
 			}
 
-			if e.Keysym.Sym == sdl.K_LSHIFT || e.Keysym.Sym == sdl.K_RSHIFT {
-				imIo.SetKeyShift(e.Type == sdl.KEYDOWN)
+			if we.Event == sdl.WINDOWEVENT_SIZE_CHANGED {
+				target.handleWindowResize()
 			}
+		}
 
-			if e.Keysym.Sym == sdl.K_LALT || e.Keysym.Sym == sdl.K_RALT {
-				imIo.SetKeyAlt(e.Type == sdl.KEYDOWN)
-			}
+		if target != w {
+			continue
+		}
 
-			if e.Keysym.Sym == sdl.K_LGUI || e.Keysym.Sym == sdl.K_RGUI {
-				imIo.SetKeySuper(e.Type == sdl.KEYDOWN)
-			}
+		processEvent(event)
+	}
+}
+
+func (w *Window) handleWindowResize() {
 
-		case *sdl.TextInputEvent:
-			imIo.AddInputCharactersUTF8(e.GetText())
+	// Other windows get their viewport set when they are made current
+	if currentWin != w {
+		return
+	}
 
-		case *sdl.MouseButtonEvent:
-			input.HandleMouseBtnEvent(e)
+	fbWidth, fbHeight := w.SDLWin.GLGetDrawableSize()
+	if fbWidth <= 0 || fbHeight <= 0 {
+		return
+	}
+	gl.Viewport(0, 0, fbWidth, fbHeight)
+}
 
-		case *sdl.MouseMotionEvent:
-			input.HandleMouseMotionEvent(e)
+// Destroy removes the window from the open windows, and deletes its GL context if no other window uses it.
+// Calling this on an already destroyed window does nothing.
+//
+// If this is the window passed to Run then the game ends, but the window is only hidden and its GL context kept alive until after
+// Game.DeInit, so that levels and the game can still free their GL resources
+func (w *Window) Destroy() error {
 
-		case *sdl.WindowEvent:
-			if e.Event == sdl.WINDOWEVENT_SIZE_CHANGED {
-				w.handleWindowResize()
-			}
+	if w.isDestroyed {
+		return nil
+	}
+	w.isDestroyed = true
 
-		case *sdl.QuitEvent:
-			input.HandleQuitEvent(e)
+	for i := 0; i < len(windows); i++ {
+		if windows[i] == w {
+			windows = append(windows[:i], windows[i+1:]...)
+			break
 		}
 	}
 
-	// If a mouse press event came, always pass it as "mouse held this frame", so we don't miss click-release events that are shorter than 1 frame.
-	x, y, _ := sdl.GetMouseState()
-	imIo.SetMousePos(imgui.Vec2{X: float32(x), Y: float32(y)})
+	if currentWin == w {
+		currentWin = nil
+	}
+
+	if w == runningMainWin {
+		w.SDLWin.Hide()
+		return nil
+	}
 
-	imIo.SetMouseButtonDown(0, input.MouseDown(sdl.BUTTON_LEFT))
-	imIo.SetMouseButtonDown(1, input.MouseDown(sdl.BUTTON_RIGHT))
-	imIo.SetMouseButtonDown(2, input.MouseDown(sdl.BUTTON_MIDDLE))
+	return w.release()
 }
 
-func (w *Window) handleWindowResize() {
+// release deletes the GL context of a destroyed window if no other window uses it, then destroys the SDL window
+func (w *Window) release() error {
 
-	fbWidth, fbHeight := w.SDLWin.GLGetDrawableSize()
-	if fbWidth <= 0 || fbHeight <= 0 {
-		return
+	glCtxRefCounts[w.GlCtx]--
+	if glCtxRefCounts[w.GlCtx] <= 0 {
+		delete(glCtxRefCounts, w.GlCtx)
+		sdl.GLDeleteContext(w.GlCtx)
 	}
-	gl.Viewport(0, 0, fbWidth, fbHeight)
-}
 
-func (w *Window) Destroy() error {
 	return w.SDLWin.Destroy()
 }
 
@@ -154,37 +178,84 @@ func initSDL() error {
 }
 
 func CreateOpenGLWindow(title string, x, y, width, height int32, flags WindowFlags, rend renderer.Render) (*Window, error) {
-	return createWindow(title, x, y, width, height, WindowFlags_OPENGL|flags, rend)
+	return createWindow(title, x, y, width, height, WindowFlags_OPENGL|flags, rend, nil)
 }
 
 func CreateOpenGLWindowCentered(title string, width, height int32, flags WindowFlags, rend renderer.Render) (*Window, error) {
-	return createWindow(title, sdl.WINDOWPOS_CENTERED, sdl.WINDOWPOS_CENTERED, width, height, WindowFlags_OPENGL|flags, rend)
+	return createWindow(title, sdl.WINDOWPOS_CENTERED, sdl.WINDOWPOS_CENTERED, width, height, WindowFlags_OPENGL|flags, rend, nil)
+}
+
+// CreateOpenGLWindowWithOptions is used to create windows that share GL contexts or resources with other windows
+func CreateOpenGLWindowWithOptions(title string, x, y, width, height int32, flags WindowFlags, rend renderer.Render, opts *WindowOptions) (*Window, error) {
+	return createWindow(title, x, y, width, height, WindowFlags_OPENGL|flags, rend, opts)
 }
 
-func createWindow(title string, x, y, width, height int32, flags WindowFlags, rend renderer.Render) (*Window, error) {
+func createWindow(title string, x, y, width, height int32, flags WindowFlags, rend renderer.Render, opts *WindowOptions) (*Window, error) {
 
 	assert.T(isInited, "engine.Init() was not called!")
 
+	if opts == nil {
+		opts = &WindowOptions{}
+	}
+
+	assert.T(opts.CtxWindow == nil || !opts.CtxWindow.isDestroyed, "Can not share the GL context of a destroyed window")
+	assert.T(opts.ShareResourcesWith == nil || !opts.ShareResourcesWith.isDestroyed, "Can not share the GL resources of a destroyed window")
+
 	sdlWin, err := sdl.CreateWindow(title, x, y, width, height, uint32(flags))
 	if err != nil {
 		return nil, err
 	}
-	win := &Window{
-		SDLWin:         sdlWin,
-		EventCallbacks: make([]func(sdl.Event), 0),
-		Rend:           rend,
-	}
 
-	win.GlCtx, err = sdlWin.GLCreateContext()
+	winID, err := sdlWin.GetID()
 	if err != nil {
+		sdlWin.Destroy()
 		return nil, err
 	}
 
-	err = initOpenGL()
-	if err != nil {
-		return nil, err
+	win := &Window{
+		SDLWin:          sdlWin,
+		ID:              winID,
+		EventCallbacks:  make([]func(sdl.Event), 0),
+		CloseCallbacks:  make([]func(w *Window), 0),
+		RenderCallbacks: make([]func(w *Window), 0),
+		Rend:            rend,
+	}
+
+	if opts.CtxWindow != nil {
+
+		win.GlCtx = opts.CtxWindow.GlCtx
+		err = sdlWin.GLMakeCurrent(win.GlCtx)
+		if err != nil {
+			sdlWin.Destroy()
+			return nil, err
+		}
+	} else {
+
+		if opts.ShareResourcesWith != nil {
+			opts.ShareResourcesWith.MakeCurrent()
+			sdl.GLSetAttribute(sdl.GL_SHARE_WITH_CURRENT_CONTEXT, 1)
+		}
+
+		win.GlCtx, err = sdlWin.GLCreateContext()
+		sdl.GLSetAttribute(sdl.GL_SHARE_WITH_CURRENT_CONTEXT, 0)
+		if err != nil {
+			sdlWin.Destroy()
+			return nil, err
+		}
+
+		err = initOpenGL()
+		if err != nil {
+			sdl.GLDeleteContext(win.GlCtx)
+			sdlWin.Destroy()
+			return nil, err
+		}
 	}
 
+	// Creating a window makes it current
+	currentWin = win
+	glCtxRefCounts[win.GlCtx]++
+	windows = append(windows, win)
+
 	return win, err
 }
 
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"sort"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/input"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	EventProcessorPriority_Imgui   = 1000
+	EventProcessorPriority_Default = 0
+	EventProcessorPriority_Input   = -1000
+)
+
+// EventProcessor gets the events of the main window (and events not for any window) every frame.
+// Processors are run from the highest priority to the lowest, and processors with the same priority run in the order they were added
+type EventProcessor struct {
+	Name     string
+	Priority int
+
+	// Process returns true to consume the event, in which case lower priority processors don't get it
+	Process func(event sdl.Event) bool
+}
+
+var (
+	// eventProcessors is kept sorted by priority. The input package is always registered so gameplay
+	// gets input, while imgui is registered by Run
+	eventProcessors = []EventProcessor{
+		{
+			Name:     "input",
+			Priority: EventProcessorPriority_Input,
+			Process: func(event sdl.Event) bool {
+				input.HandleEvent(event)
+				return false
+			},
+		},
+	}
+)
+
+// AddEventProcessor adds the processor to the chain, replacing any processor with the same name
+func AddEventProcessor(p EventProcessor) {
+
+	assert.T(p.Name != "", "Event processor name can not be empty")
+	assert.T(p.Process != nil, "Event processor '%s' has a nil Process function", p.Name)
+
+	RemoveEventProcessor(p.Name)
+
+	eventProcessors = append(eventProcessors, p)
+	sort.SliceStable(eventProcessors, func(i, j int) bool {
+		return eventProcessors[i].Priority > eventProcessors[j].Priority
+	})
+}
+
+// RemoveEventProcessor returns false if there is no processor with this name
+func RemoveEventProcessor(name string) bool {
+
+	for i := 0; i < len(eventProcessors); i++ {
+		if eventProcessors[i].Name == name {
+			eventProcessors = append(eventProcessors[:i], eventProcessors[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// processEvent runs the event through the processors until one consumes it
+func processEvent(event sdl.Event) {
+
+	for i := 0; i < len(eventProcessors); i++ {
+		if eventProcessors[i].Process(event) {
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/timing"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	DefaultSpinThreshold = 2 * time.Millisecond
+)
+
+// FrameLimits caps the frame rate of Run. This is separate from VSync, and both can be used together
+type FrameLimits struct {
+	// FocusedFPS is the cap while the main window has input focus. Zero means no cap
+	FocusedFPS float32
+
+	// UnfocusedFPS is the cap while the main window doesn't have input focus. Zero means use FocusedFPS
+	UnfocusedFPS float32
+
+	// MinimizedFPS is the cap while the main window is minimized or hidden. Zero means use UnfocusedFPS
+	MinimizedFPS float32
+
+	// SpinThreshold is how much of the wait at the end of a frame is spent spinning instead of sleeping,
+	// which is needed for accurate pacing because sleeps can wake up late. Higher values use more CPU
+	SpinThreshold time.Duration
+}
+
+var (
+	frameLimits = FrameLimits{
+		SpinThreshold: DefaultSpinThreshold,
+	}
+)
+
+func SetFrameLimits(limits FrameLimits) {
+
+	assert.T(limits.FocusedFPS >= 0 && limits.UnfocusedFPS >= 0 && limits.MinimizedFPS >= 0, "Frame limits can not be negative, but got %+v", limits)
+	assert.T(limits.SpinThreshold >= 0, "Spin threshold can not be negative, but got %v", limits.SpinThreshold)
+	frameLimits = limits
+}
+
+func GetFrameLimits() FrameLimits {
+	return frameLimits
+}
+
+// SetTargetFPS sets the frame rate cap used while the main window is focused. Zero removes the cap
+func SetTargetFPS(fps float32) {
+	assert.T(fps >= 0, "Target FPS can not be negative, but got %f", fps)
+	frameLimits.FocusedFPS = fps
+}
+
+// currentFPSCap returns the cap that applies given the state of the window, or zero if there is none
+func currentFPSCap(w *Window) float32 {
+
+	fps := frameLimits.FocusedFPS
+
+	flags := w.SDLWin.GetFlags()
+	if flags&sdl.WINDOW_INPUT_FOCUS == 0 && frameLimits.UnfocusedFPS > 0 {
+		fps = frameLimits.UnfocusedFPS
+	}
+
+	if flags&(sdl.WINDOW_MINIMIZED|sdl.WINDOW_HIDDEN) != 0 && frameLimits.MinimizedFPS > 0 {
+		fps = frameLimits.MinimizedFPS
+	}
+
+	return fps
+}
+
+// limitFrameRate waits out the rest of the frame if there is a cap, and must be called just before timing.FrameEnded
+func limitFrameRate(w *Window) {
+
+	fps := currentFPSCap(w)
+	if fps <= 0 {
+		timing.WaitForFrameTime(0, frameLimits.SpinThreshold)
+		return
+	}
+
+	timing.WaitForFrameTime(time.Duration(float64(time.Second)/float64(fps)), frameLimits.SpinThreshold)
+}
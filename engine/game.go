@@ -1,6 +1,10 @@
 package engine
 
 import (
+	"github.com/bloeys/nmage/entity"
+	"github.com/bloeys/nmage/jobs"
+	"github.com/bloeys/nmage/logging"
+	"github.com/bloeys/nmage/systems"
 	"github.com/bloeys/nmage/timing"
 	nmageimgui "github.com/bloeys/nmage/ui/imgui"
 	"github.com/go-gl/gl/v4.1-core/gl"
@@ -8,8 +12,25 @@ import (
 
 var (
 	isRunning = false
+
+	// runningMainWin is the window passed to Run. Destroying it is delayed until the game is deinitialized
+	runningMainWin *Window
+
+	// Systems are run by Run every frame according to their phase.
+	// Systems can be registered up to and including Game.Init
+	Systems = systems.NewScheduler()
+
+	// Events queued on this bus are delivered at the end of every frame, before Game.FrameEnd
+	Events = entity.NewEventBus()
 )
 
+// FixedUpdater can optionally be implemented by a Game to have FixedUpdate called every timing.FixedDT seconds.
+// FixedUpdate might run zero or more times per frame, and runs before Update.
+// Render can use timing.InterpolationAlpha to smooth out state set in FixedUpdate
+type FixedUpdater interface {
+	FixedUpdate()
+}
+
 type Game interface {
 	Init()
 
@@ -23,6 +44,17 @@ type Game interface {
 func Run(g Game, w *Window, ui nmageimgui.ImguiInfo) {
 
 	isRunning = true
+	runningMainWin = w
+	fixedUpdater, _ := g.(FixedUpdater)
+
+	// The main window might not be current if other windows were created after it
+	w.MakeCurrent()
+
+	AddEventProcessor(EventProcessor{
+		Name:     "imgui",
+		Priority: EventProcessorPriority_Imgui,
+		Process:  ui.ProcessEvent,
+	})
 
 	// Run init with an active Imgui frame to allow init full imgui access
 	timing.FrameStarted()
@@ -31,14 +63,17 @@ func Run(g Game, w *Window, ui nmageimgui.ImguiInfo) {
 	width, height := w.SDLWin.GetSize()
 	ui.FrameStart(float32(width), float32(height))
 
-	g.Init()
+	initGame(g)
 
 	fbWidth, fbHeight := w.SDLWin.GLGetDrawableSize()
 	ui.Render(float32(width), float32(height), fbWidth, fbHeight)
 
 	timing.FrameEnded()
 
-	for isRunning {
+	// Levels requested in Init are active from the first frame
+	applyLevelChanges()
+
+	for isRunning && !w.isDestroyed {
 
 		//PERF: Cache these
 		width, height = w.SDLWin.GetSize()
@@ -48,19 +83,107 @@ func Run(g Game, w *Window, ui nmageimgui.ImguiInfo) {
 		w.handleInputs()
 		ui.FrameStart(float32(width), float32(height))
 
-		g.Update()
+		updateGame(g, fixedUpdater)
+
+		// Close callbacks or game code might have destroyed the main window, which ends the game
+		if w.isDestroyed {
+			break
+		}
 
 		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT | gl.STENCIL_BUFFER_BIT)
+		subsystemsPreRender()
+		Systems.RunPhase(systems.Phase_PreRender)
 		g.Render()
 		ui.Render(float32(width), float32(height), fbWidth, fbHeight)
+		subsystemsPostRender()
 		w.SDLWin.GLSwap()
+		renderSecondaryWindows(w)
 
+		Events.FlushQueued()
 		g.FrameEnd()
 		w.Rend.FrameEnd()
+
+		limitFrameRate(w)
 		timing.FrameEnded()
+
+		// Level changes happen between frames so they don't count towards frame time
+		applyLevelChanges()
 	}
 
+	// A destroyed main window still has its context, which must be current for DeInit to free GL resources
+	if w.isDestroyed {
+		err := w.SDLWin.GLMakeCurrent(w.GlCtx)
+		if err != nil {
+			logging.ErrLog.Println("Failed to make the destroyed main window current for DeInit. Err:", err)
+		}
+		currentWin = nil
+	}
+
+	deInitGame(g)
+
+	runningMainWin = nil
+	if w.isDestroyed {
+		err := w.release()
+		if err != nil {
+			logging.ErrLog.Println("Failed to destroy main window. Err:", err)
+		}
+	}
+}
+
+// initGame is shared by Run and RunHeadless
+func initGame(g Game) {
+
+	Jobs = jobs.NewPool(0)
+	runMainThreadFuncs()
+
+	err := initSubsystems()
+	if err != nil {
+		logging.ErrLog.Fatalln(err)
+	}
+
+	g.Init()
+
+	// Ordering problems are reported before the first frame
+	err = Systems.Build()
+	if err != nil {
+		logging.ErrLog.Fatalln("Failed to build systems. Err:", err)
+	}
+}
+
+// updateGame runs everything up to (but not including) rendering, and is shared by Run and RunHeadless
+func updateGame(g Game, fixedUpdater FixedUpdater) {
+
+	runMainThreadFuncs()
+
+	subsystemsPreUpdate()
+	Systems.RunPhase(systems.Phase_PreUpdate)
+
+	fixedSteps := timing.FixedStepsThisFrame()
+	for i := 0; i < fixedSteps; i++ {
+
+		Systems.RunPhase(systems.Phase_FixedUpdate)
+		if fixedUpdater != nil {
+			fixedUpdater.FixedUpdate()
+		}
+	}
+
+	Systems.RunPhase(systems.Phase_Update)
+	updateLevels()
+	g.Update()
+	Systems.RunPhase(systems.Phase_LateUpdate)
+	subsystemsPostUpdate()
+}
+
+// deInitGame is shared by Run and RunHeadless
+func deInitGame(g Game) {
+
+	// Run anything still queued so no one waits forever on a main thread future
+	runMainThreadFuncs()
+
+	unloadAllLevels()
 	g.DeInit()
+	shutdownSubsystems()
+	closeJobs()
 }
 
 func Quit() {
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/bloeys/nmage/input"
+	"github.com/bloeys/nmage/timing"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+type HeadlessOptions struct {
+	// MaxFrames stops the game after this many frames. Zero means run until Quit is called
+	MaxFrames uint64
+
+	// FrameDT, if more than zero, is used as the DT of every frame instead of the measured frame time.
+	// This makes runs deterministic, which is useful for tests and simulations
+	FrameDT float32
+
+	// PaceToRealTime sleeps at the end of each frame so that frames take at least FrameDT seconds of real time,
+	// which is what a dedicated server usually wants. Has no effect if FrameDT is zero
+	PaceToRealTime bool
+
+	// InputSource, if set, is called once per frame and the returned events are passed to the event processors
+	// as if they came from the main window
+	InputSource func() []sdl.Event
+}
+
+// RunHeadless runs the game without a window, GL context or imgui. engine.Init is not required.
+//
+// The update loop, timing, systems, events and levels work just like in Run, but Game.Render is never called
+// and neither are systems in the PreRender phase or the render functions of subsystems
+func RunHeadless(g Game, opts *HeadlessOptions) {
+
+	if opts == nil {
+		opts = &HeadlessOptions{}
+	}
+
+	runtime.LockOSThread()
+	timing.Init()
+
+	isRunning = true
+	fixedUpdater, _ := g.(FixedUpdater)
+
+	timing.FrameStarted()
+	injectInputs(opts)
+	initGame(g)
+	endHeadlessFrame(opts)
+
+	applyLevelChanges()
+
+	for frame := uint64(0); isRunning && (opts.MaxFrames == 0 || frame < opts.MaxFrames); frame++ {
+
+		timing.FrameStarted()
+		injectInputs(opts)
+
+		updateGame(g, fixedUpdater)
+
+		Events.FlushQueued()
+		g.FrameEnd()
+		endHeadlessFrame(opts)
+
+		applyLevelChanges()
+	}
+
+	isRunning = false
+	deInitGame(g)
+}
+
+func injectInputs(opts *HeadlessOptions) {
+
+	input.EventLoopStart()
+	if opts.InputSource == nil {
+		return
+	}
+
+	events := opts.InputSource()
+	for i := 0; i < len(events); i++ {
+		processEvent(events[i])
+	}
+}
+
+func endHeadlessFrame(opts *HeadlessOptions) {
+
+	if opts.FrameDT <= 0 {
+		timing.FrameEnded()
+		return
+	}
+
+	if opts.PaceToRealTime {
+		timing.WaitForFrameTime(time.Duration(float64(opts.FrameDT)*float64(time.Second)), frameLimits.SpinThreshold)
+	}
+
+	timing.FrameEndedWithDT(opts.FrameDT)
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+// headlessTestGame records the order of the Game calls it gets
+type headlessTestGame struct {
+	t     *testing.T
+	calls []string
+}
+
+func (g *headlessTestGame) record(call string) {
+
+	g.calls = append(g.calls, call)
+
+	if len(Windows()) != 0 || currentWin != nil || len(glCtxRefCounts) != 0 {
+		g.t.Errorf("Expected no windows or GL contexts in headless mode during %s, but have %d windows and %d contexts", call, len(Windows()), len(glCtxRefCounts))
+	}
+}
+
+func (g *headlessTestGame) Init()     { g.record("Init") }
+func (g *headlessTestGame) Update()   { g.record("Update") }
+func (g *headlessTestGame) Render()   { g.record("Render") }
+func (g *headlessTestGame) FrameEnd() { g.record("FrameEnd") }
+func (g *headlessTestGame) DeInit()   { g.record("DeInit") }
+
+func TestRunHeadless(t *testing.T) {
+
+	g := &headlessTestGame{t: t}
+	RunHeadless(g, &HeadlessOptions{
+		MaxFrames: 3,
+		FrameDT:   1.0 / 60,
+	})
+
+	expected := []string{
+		"Init",
+		"Update", "FrameEnd",
+		"Update", "FrameEnd",
+		"Update", "FrameEnd",
+		"DeInit",
+	}
+
+	if !reflect.DeepEqual(g.calls, expected) {
+		t.Fatalf("Expected game calls %v, but got %v", expected, g.calls)
+	}
+
+	if isInited || isRunning {
+		t.Fatalf("Expected headless run to not need engine.Init and to stop running once done, but got isInited=%v and isRunning=%v", isInited, isRunning)
+	}
+}
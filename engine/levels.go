@@ -0,0 +1,331 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/assets"
+	"github.com/bloeys/nmage/level"
+	"github.com/bloeys/nmage/logging"
+)
+
+var (
+	ErrUnknownLevel       = errors.New("no level is registered with this name")
+	ErrLevelLoadCancelled = errors.New("level load was cancelled because the main level changed while loading")
+)
+
+// LevelSource creates a level, and optionally reports progress in the range [0, 1] while doing so. onProgress is never nil.
+//
+// Sources are called on the main thread by LoadLevel, and on a background goroutine by LoadSubLevelAsync.
+// Since a source might not run on the main thread it must not run component code (e.g. by using entity.AddComp) or use the Events bus.
+// Components should instead be added using level.Level.AddCompDeferred, and are then added on the main thread before the level becomes active
+type LevelSource func(onProgress func(progress float32)) (*level.Level, error)
+
+var (
+	levelSources = make(map[string]LevelSource)
+
+	currLevel *level.Level
+	subLevels = make([]*level.Level, 0)
+
+	// levelGeneration increases every time the main level changes, and is used to drop sub-levels loaded for an older main level
+	levelGeneration uint64
+
+	pendingLevelName       string
+	hasPendingLevel        bool
+	pendingSubLevelLoads   = make([]*LevelLoad, 0)
+	pendingSubLevelUnloads = make([]*level.Level, 0)
+
+	// LevelLoadedCallbacks are called on the main thread between frames after a level becomes active
+	LevelLoadedCallbacks []func(l *level.Level, isSubLevel bool)
+
+	// LevelUnloadingCallbacks are called on the main thread between frames before a level's entities are destroyed.
+	// This is where games should free any level assets not in the texture cache
+	LevelUnloadingCallbacks []func(l *level.Level, isSubLevel bool)
+)
+
+// LevelLoad tracks a sub-level being loaded by LoadSubLevelAsync
+type LevelLoad struct {
+	Name string
+
+	// progress holds the bits of a float32
+	progress uint32
+	isLoaded uint32
+	isDone   bool
+
+	generation uint64
+	level      *level.Level
+	err        error
+}
+
+// Progress returns a value in the range [0, 1]. It is safe to call from any goroutine
+func (ll *LevelLoad) Progress() float32 {
+	return math.Float32frombits(atomic.LoadUint32(&ll.progress))
+}
+
+func (ll *LevelLoad) setProgress(progress float32) {
+	atomic.StoreUint32(&ll.progress, math.Float32bits(progress))
+}
+
+// IsDone returns true once the sub-level has been added to the active sub-levels or has failed to load.
+// Must be called on the main thread
+func (ll *LevelLoad) IsDone() bool {
+	return ll.isDone
+}
+
+// Level returns the loaded sub-level, or nil if loading is not done or has failed.
+// Must be called on the main thread
+func (ll *LevelLoad) Level() *level.Level {
+	return ll.level
+}
+
+// Err returns the load error, if any, once IsDone is true. Must be called on the main thread
+func (ll *LevelLoad) Err() error {
+	return ll.err
+}
+
+// RegisterLevel makes a level loadable by name using LoadLevel and LoadSubLevelAsync
+func RegisterLevel(name string, src LevelSource) {
+	assert.T(name != "", "Level name can not be empty")
+	assert.T(src != nil, "Level source can not be nil")
+	levelSources[name] = src
+}
+
+// RegisterLevelFile registers a level that is loaded from a scene file written by level.Level.Save
+func RegisterLevelFile(name, path string) {
+	RegisterLevel(name, func(onProgress func(progress float32)) (*level.Level, error) {
+		return level.LoadFileDeferred(path, onProgress)
+	})
+}
+
+// CurrentLevel returns the active main level, or nil if none is loaded
+func CurrentLevel() *level.Level {
+	return currLevel
+}
+
+// SubLevels returns the active sub-levels. The returned slice must not be modified
+func SubLevels() []*level.Level {
+	return subLevels
+}
+
+// LoadLevel switches the main level. The switch happens between frames, at which point the current level
+// and all sub-levels are unloaded. If this is called multiple times in one frame then only the last call takes effect.
+//
+// If loading the new level fails then the error is logged and the current level is kept
+func LoadLevel(name string) error {
+
+	if _, ok := levelSources[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownLevel, name)
+	}
+
+	pendingLevelName = name
+	hasPendingLevel = true
+	return nil
+}
+
+// LoadSubLevelAsync loads a level on a background goroutine and then adds it to the active sub-levels between frames.
+// The main level is not affected.
+//
+// If the main level changes before loading is done then the sub-level is dropped and the load fails with ErrLevelLoadCancelled
+func LoadSubLevelAsync(name string) (*LevelLoad, error) {
+
+	src, ok := levelSources[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLevel, name)
+	}
+
+	ll := &LevelLoad{
+		Name:       name,
+		generation: levelGeneration,
+	}
+	pendingSubLevelLoads = append(pendingSubLevelLoads, ll)
+
+	go func() {
+
+		l, err := src(ll.setProgress)
+
+		ll.level = l
+		ll.err = err
+		atomic.StoreUint32(&ll.isLoaded, 1)
+	}()
+
+	return ll, nil
+}
+
+// UnloadSubLevel removes the sub-level and destroys its entities between frames
+func UnloadSubLevel(l *level.Level) {
+	pendingSubLevelUnloads = append(pendingSubLevelUnloads, l)
+}
+
+// applyLevelChanges does all pending level work. Must only be called between frames
+func applyLevelChanges() {
+
+	// Finished async loads
+	for i := 0; i < len(pendingSubLevelLoads); i++ {
+
+		ll := pendingSubLevelLoads[i]
+		if atomic.LoadUint32(&ll.isLoaded) == 0 {
+			continue
+		}
+
+		pendingSubLevelLoads[i] = pendingSubLevelLoads[len(pendingSubLevelLoads)-1]
+		pendingSubLevelLoads = pendingSubLevelLoads[:len(pendingSubLevelLoads)-1]
+		i--
+
+		ll.isDone = true
+		if ll.err != nil {
+			ll.level = nil
+			logging.ErrLog.Printf("Failed to load sub-level '%s'. Err: %v\n", ll.Name, ll.err)
+			continue
+		}
+
+		if ll.generation != levelGeneration {
+			ll.level.Clear()
+			ll.level = nil
+			ll.err = ErrLevelLoadCancelled
+			continue
+		}
+
+		ll.level.AddDeferredComps()
+		ll.setProgress(1)
+		subLevels = append(subLevels, ll.level)
+		for _, cb := range LevelLoadedCallbacks {
+			cb(ll.level, true)
+		}
+	}
+
+	// Sub-level unloads
+	if len(pendingSubLevelUnloads) > 0 {
+
+		for _, l := range pendingSubLevelUnloads {
+
+			index := -1
+			for i := 0; i < len(subLevels); i++ {
+				if subLevels[i] == l {
+					index = i
+					break
+				}
+			}
+
+			if index == -1 {
+				continue
+			}
+
+			subLevels = append(subLevels[:index], subLevels[index+1:]...)
+			unloadLevel(l, true)
+		}
+
+		pendingSubLevelUnloads = pendingSubLevelUnloads[:0]
+	}
+
+	// Main level switch
+	if !hasPendingLevel {
+		return
+	}
+
+	hasPendingLevel = false
+	// Sources are allowed to report progress, so they always get a callback even though a synchronous switch doesn't track it
+	newLevel, err := levelSources[pendingLevelName](func(progress float32) {})
+	if err != nil {
+		logging.ErrLog.Printf("Failed to load level '%s'. Err: %v\n", pendingLevelName, err)
+		return
+	}
+
+	oldLevel := currLevel
+	oldSubLevels := subLevels
+
+	newLevel.AddDeferredComps()
+	currLevel = newLevel
+	subLevels = make([]*level.Level, 0)
+	levelGeneration++
+
+	for _, l := range oldSubLevels {
+		unloadLevel(l, true)
+	}
+
+	if oldLevel != nil {
+		unloadLevel(oldLevel, false)
+	}
+
+	for _, cb := range LevelLoadedCallbacks {
+		cb(currLevel, false)
+	}
+}
+
+// unloadLevel destroys the entities of the level and frees its cached textures that no active level references.
+// The level must already be removed from the active levels
+func unloadLevel(l *level.Level, isSubLevel bool) {
+
+	for _, cb := range LevelUnloadingCallbacks {
+		cb(l, isSubLevel)
+	}
+
+	inUse := make(map[string]struct{})
+	addTexturePaths := func(al *level.Level) {
+		for _, a := range al.Assets {
+			if a.Type != level.AssetType_Texture {
+				continue
+			}
+
+			for _, p := range a.Paths {
+				inUse[p] = struct{}{}
+			}
+		}
+	}
+
+	if currLevel != nil {
+		addTexturePaths(currLevel)
+	}
+
+	for _, sl := range subLevels {
+		addTexturePaths(sl)
+	}
+
+	for _, a := range l.Assets {
+
+		if a.Type != level.AssetType_Texture {
+			continue
+		}
+
+		for _, p := range a.Paths {
+			if _, ok := inUse[p]; !ok {
+				assets.UnloadTextureFromCachePath(p)
+			}
+		}
+	}
+
+	l.Clear()
+}
+
+// unloadAllLevels is used on shutdown
+func unloadAllLevels() {
+
+	oldLevel := currLevel
+	oldSubLevels := subLevels
+
+	currLevel = nil
+	subLevels = make([]*level.Level, 0)
+	levelGeneration++
+
+	for _, l := range oldSubLevels {
+		unloadLevel(l, true)
+	}
+
+	if oldLevel != nil {
+		unloadLevel(oldLevel, false)
+	}
+}
+
+// updateLevels updates the components of all entities in the active levels
+func updateLevels() {
+
+	if currLevel != nil {
+		currLevel.UpdateEntities()
+	}
+
+	for _, l := range subLevels {
+		l.UpdateEntities()
+	}
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bloeys/nmage/jobs"
+)
+
+var (
+	// Jobs is the engine worker pool, used for work that doesn't have to happen on the main thread.
+	// It is created when the game starts (before Game.Init) and closed after Game.DeInit, and is nil outside of that
+	Jobs *jobs.Pool
+
+	mainThreadFuncsLock sync.Mutex
+	mainThreadFuncs     = make([]func(), 0)
+)
+
+// RunOnMainThread queues fn to run on the main thread, and is safe to call from any goroutine.
+// Queued functions run every frame after events are handled and before any updates, in the order they were queued.
+// Functions queued while the queue is being run are run in the next frame.
+//
+// This is how goroutines should do GL work, like uploading textures loaded in the background
+func RunOnMainThread(fn func()) {
+	mainThreadFuncsLock.Lock()
+	mainThreadFuncs = append(mainThreadFuncs, fn)
+	mainThreadFuncsLock.Unlock()
+}
+
+// RunOnMainThreadFuture is like RunOnMainThread but returns a future of the result.
+//
+// Waiting on the future from the main thread blocks forever, so the main thread should use Future.Result instead
+func RunOnMainThreadFuture[T any](fn func() (T, error)) *jobs.Future[T] {
+
+	f := jobs.NewFuture[T]()
+	RunOnMainThread(func() {
+		f.Complete(fn())
+	})
+
+	return f
+}
+
+// runMainThreadFuncs runs the functions queued so far. Must only be called on the main thread
+func runMainThreadFuncs() {
+
+	mainThreadFuncsLock.Lock()
+	funcs := mainThreadFuncs
+	mainThreadFuncs = make([]func(), 0, len(funcs))
+	mainThreadFuncsLock.Unlock()
+
+	for i := 0; i < len(funcs); i++ {
+		funcs[i]()
+	}
+}
+
+// closeJobs closes the worker pool. Main thread functions keep running while waiting,
+// so that jobs waiting on main thread futures can finish
+func closeJobs() {
+
+	if Jobs == nil {
+		return
+	}
+
+	pool := Jobs
+	closed := make(chan struct{})
+	go func() {
+		pool.Close()
+		close(closed)
+	}()
+
+	for {
+
+		runMainThreadFuncs()
+
+		select {
+		case <-closed:
+			Jobs = nil
+			return
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bloeys/nmage/assert"
+)
+
+// Subsystem is an engine plugin (e.g. audio or physics) whose functions are called at set points of the game loop.
+// Subsystems with a higher priority are called first, except in Shutdown, which runs in the reverse order.
+//
+// PreRender and PostRender are not called by RunHeadless. Embed BaseSubsystem to only implement the needed functions
+type Subsystem interface {
+	Name() string
+
+	// Init is called by Run and RunHeadless before Game.Init
+	Init() error
+
+	// PreUpdate is called after events are handled but before any systems or the game are updated
+	PreUpdate()
+
+	// PostUpdate is called after the game and all update systems have run
+	PostUpdate()
+
+	// PreRender is called after the screen is cleared but before any rendering
+	PreRender()
+
+	// PostRender is called after the game and imgui have rendered, but before the buffers are swapped
+	PostRender()
+
+	// Shutdown is called after Game.DeInit. Subsystems whose Init failed are not shut down
+	Shutdown()
+}
+
+// BaseSubsystem implements all Subsystem functions as no-ops, except Name which must be implemented by the embedding type
+type BaseSubsystem struct {
+}
+
+func (b *BaseSubsystem) Init() error {
+	return nil
+}
+
+func (b *BaseSubsystem) PreUpdate() {
+}
+
+func (b *BaseSubsystem) PostUpdate() {
+}
+
+func (b *BaseSubsystem) PreRender() {
+}
+
+func (b *BaseSubsystem) PostRender() {
+}
+
+func (b *BaseSubsystem) Shutdown() {
+}
+
+type registeredSubsystem struct {
+	Subsystem
+	priority int
+}
+
+var (
+	// subsystems is sorted by priority, highest first
+	subsystems = make([]registeredSubsystem, 0)
+
+	// initedSubsystemCount is the number of subsystems, from the start of subsystems, that were successfully initialized
+	initedSubsystemCount int
+	areSubsystemsInited  bool
+)
+
+// RegisterSubsystem must be called before Run. Subsystems with the same priority run in the order they were registered
+func RegisterSubsystem(s Subsystem, priority int) {
+
+	assert.T(!areSubsystemsInited, "Subsystems can not be registered after the game has started, but got '%s'", s.Name())
+	assert.T(GetSubsystem(s.Name()) == nil, "A subsystem named '%s' is already registered", s.Name())
+
+	subsystems = append(subsystems, registeredSubsystem{Subsystem: s, priority: priority})
+	sort.SliceStable(subsystems, func(i, j int) bool {
+		return subsystems[i].priority > subsystems[j].priority
+	})
+}
+
+// GetSubsystem returns nil if no subsystem with this name is registered
+func GetSubsystem(name string) Subsystem {
+
+	for i := 0; i < len(subsystems); i++ {
+		if subsystems[i].Name() == name {
+			return subsystems[i].Subsystem
+		}
+	}
+
+	return nil
+}
+
+// initSubsystems stops at the first failed Init, after shutting down the subsystems that were inited
+func initSubsystems() error {
+
+	areSubsystemsInited = true
+	for i := 0; i < len(subsystems); i++ {
+
+		err := subsystems[i].Init()
+		if err != nil {
+			shutdownSubsystems()
+			return fmt.Errorf("failed to init subsystem '%s': %w", subsystems[i].Name(), err)
+		}
+
+		initedSubsystemCount++
+	}
+
+	return nil
+}
+
+func shutdownSubsystems() {
+
+	for i := initedSubsystemCount - 1; i >= 0; i-- {
+		subsystems[i].Shutdown()
+	}
+
+	initedSubsystemCount = 0
+}
+
+func subsystemsPreUpdate() {
+	for i := 0; i < len(subsystems); i++ {
+		subsystems[i].PreUpdate()
+	}
+}
+
+func subsystemsPostUpdate() {
+	for i := 0; i < len(subsystems); i++ {
+		subsystems[i].PostUpdate()
+	}
+}
+
+func subsystemsPreRender() {
+	for i := 0; i < len(subsystems); i++ {
+		subsystems[i].PreRender()
+	}
+}
+
+func subsystemsPostRender() {
+	for i := 0; i < len(subsystems); i++ {
+		subsystems[i].PostRender()
+	}
+}
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"github.com/bloeys/nmage/assert"
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+type WindowOptions struct {
+	// CtxWindow, if set, makes the new window use the GL context of this window instead of creating a new one.
+	// All GL state (bound objects, viewport etc.) is then shared between the windows
+	CtxWindow *Window
+
+	// ShareResourcesWith, if set and CtxWindow is nil, creates a new GL context that shares resources like textures
+	// and buffers with the context of this window. Container objects like VAOs and framebuffers are never shared between contexts
+	ShareResourcesWith *Window
+}
+
+var (
+	// windows holds all windows that are not destroyed, in creation order
+	windows = make([]*Window, 0, 1)
+
+	// glCtxRefCounts is the number of windows using each context, so a context is only deleted with its last window
+	glCtxRefCounts = make(map[sdl.GLContext]int)
+
+	currentWin *Window
+)
+
+// Windows returns all windows that are not destroyed. The returned slice must not be modified
+func Windows() []*Window {
+	return windows
+}
+
+// GetWindowByID returns nil if no open window has this ID
+func GetWindowByID(id uint32) *Window {
+
+	for i := 0; i < len(windows); i++ {
+		if windows[i].ID == id {
+			return windows[i]
+		}
+	}
+
+	return nil
+}
+
+// MakeCurrent makes the window's GL context current and draw to this window, and sets the viewport to the window size
+func (w *Window) MakeCurrent() {
+
+	assert.T(!w.isDestroyed, "Can not make a destroyed window current")
+	if currentWin == w {
+		return
+	}
+
+	err := w.SDLWin.GLMakeCurrent(w.GlCtx)
+	assert.T(err == nil, "Failed to make window current. Err: %v", err)
+
+	currentWin = w
+	fbWidth, fbHeight := w.SDLWin.GLGetDrawableSize()
+	if fbWidth > 0 && fbHeight > 0 {
+		gl.Viewport(0, 0, fbWidth, fbHeight)
+	}
+}
+
+func (w *Window) IsDestroyed() bool {
+	return w.isDestroyed
+}
+
+// handleCloseRequest runs the close callbacks of the window, or does the default close action if it has none.
+// The default is to request a quit for the main window, which matches a single window app, and to destroy other windows
+func (w *Window) handleCloseRequest(isMainWindow bool) {
+
+	if len(w.CloseCallbacks) > 0 {
+		for i := 0; i < len(w.CloseCallbacks); i++ {
+			w.CloseCallbacks[i](w)
+		}
+		return
+	}
+
+	if isMainWindow {
+		sdl.PushEvent(&sdl.QuitEvent{Type: sdl.QUIT, Timestamp: sdl.GetTicks()})
+		return
+	}
+
+	w.Destroy()
+}
+
+// renderSecondaryWindows draws all windows other than the main one using their render callbacks.
+// The main window is made current again once done
+func renderSecondaryWindows(mainWin *Window) {
+
+	if len(windows) < 2 {
+		return
+	}
+
+	for i := 0; i < len(windows); i++ {
+
+		w := windows[i]
+		if w == mainWin || len(w.RenderCallbacks) == 0 {
+			continue
+		}
+
+		w.MakeCurrent()
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT | gl.STENCIL_BUFFER_BIT)
+		for j := 0; j < len(w.RenderCallbacks); j++ {
+			w.RenderCallbacks[j](w)
+		}
+
+		w.SDLWin.GLSwap()
+		if w.Rend != nil {
+			w.Rend.FrameEnd()
+		}
+	}
+
+	mainWin.MakeCurrent()
+}
+
+// eventWindowID returns the ID of the window the event is for, and false if the event is not for a specific window
+func eventWindowID(event sdl.Event) (uint32, bool) {
+
+	switch e := event.(type) {
+	case *sdl.WindowEvent:
+		return e.WindowID, true
+	case *sdl.KeyboardEvent:
+		return e.WindowID, true
+	case *sdl.TextEditingEvent:
+		return e.WindowID, true
+	case *sdl.TextInputEvent:
+		return e.WindowID, true
+	case *sdl.MouseMotionEvent:
+		return e.WindowID, true
+	case *sdl.MouseButtonEvent:
+		return e.WindowID, true
+	case *sdl.MouseWheelEvent:
+		return e.WindowID, true
+	case *sdl.DropEvent:
+		return e.WindowID, true
+	}
+
+	return 0, false
+}
@@ -5,10 +5,19 @@ import "github.com/bloeys/nmage/registry"
 var _ Comp = &BaseComp{}
 
 type BaseComp struct {
-	Handle registry.Handle
+	Handle registry.Handle `json:"-"`
+
+	// Stored as 'disabled' so that the zero value is an enabled component
+	isDisabled  bool
+	isStarted   bool
+	isDestroyed bool
+
+	// Event subscriptions owned by this component that are removed on destroy
+	subscriptions []*Subscription
 }
 
-func (b BaseComp) baseComp() {
+func (b *BaseComp) base() *BaseComp {
+	return b
 }
 
 func (b *BaseComp) Init(parentHandle registry.Handle) {
@@ -19,6 +28,25 @@ func (b BaseComp) Name() string {
 	return "Base Component"
 }
 
+// IsEnabled reports whether the component gets updated. Use SetCompEnabled to change it
+func (b BaseComp) IsEnabled() bool {
+	return !b.isDisabled
+}
+
+// IsUnique returns false, which allows multiple components of the same type on one entity
+func (b BaseComp) IsUnique() bool {
+	return false
+}
+
+func (b BaseComp) Start() {
+}
+
+func (b BaseComp) OnEnable() {
+}
+
+func (b BaseComp) OnDisable() {
+}
+
 func (b BaseComp) Update() {
 }
 
@@ -1,6 +1,8 @@
 package entity
 
 import (
+	"reflect"
+
 	"github.com/bloeys/nmage/assert"
 	"github.com/bloeys/nmage/registry"
 )
@@ -8,34 +10,105 @@ import (
 type Comp interface {
 	// This ensures that implementors of the Comp interface
 	// always embed BaseComp
-	baseComp()
+	base() *BaseComp
 
 	Name() string
+	IsEnabled() bool
+
+	// IsUnique reports whether an entity can only have one component of this type
+	IsUnique() bool
+
+	// Init is called when the component is added
 	Init(parentHandle registry.Handle)
+
+	// Start is called once before the first update of the component
+	Start()
+
+	// OnEnable is called when the component is added while enabled, and when it gets enabled.
+	// OnDisable is called when the component gets disabled, and when it is destroyed while enabled
+	OnEnable()
+	OnDisable()
+
 	Update()
 	Destroy()
 }
 
 func NewCompContainer() CompContainer {
-	return CompContainer{Comps: []Comp{}}
+	return CompContainer{
+		Comps:     []Comp{},
+		typeIndex: make(map[reflect.Type][]Comp),
+	}
 }
 
 type CompContainer struct {
 	Comps []Comp
+
+	// typeIndex maps a concrete component type to all alive (i.e. not destroyed) components of that type in add order
+	typeIndex map[reflect.Type][]Comp
+
+	isUpdating   bool
+	hasDestroyed bool
 }
 
+// AddComp adds the component to the container and calls Init and then OnEnable (if enabled).
+// Multiple components of the same type are allowed, unless the component reports IsUnique
 func AddComp[T Comp](entityHandle registry.Handle, cc *CompContainer, c T) {
+	addComp(entityHandle, cc, c)
+}
 
-	assert.T(!HasComp[T](cc), "Entity with id '%v' already has component of type '%T'", entityHandle, c)
+// addComp is the non-generic version of AddComp, used when the component type is only known at runtime
+func addComp(entityHandle registry.Handle, cc *CompContainer, c Comp) {
+
+	if cc.typeIndex == nil {
+		cc.typeIndex = make(map[reflect.Type][]Comp)
+	}
+
+	t := reflect.TypeOf(c)
+	assert.T(!c.IsUnique() || len(cc.typeIndex[t]) == 0, "Entity with id '%v' already has component of type '%T', which is unique", entityHandle, c)
 
 	cc.Comps = append(cc.Comps, c)
+	cc.typeIndex[t] = append(cc.typeIndex[t], c)
 	c.Init(entityHandle)
+
+	if c.IsEnabled() {
+		c.OnEnable()
+	}
+}
+
+// removeFromIndex removes the component from the type index, which is done as soon as it is destroyed
+func (e *CompContainer) removeFromIndex(c Comp) {
+
+	t := reflect.TypeOf(c)
+	comps := e.typeIndex[t]
+	for i := 0; i < len(comps); i++ {
+
+		if comps[i] != c {
+			continue
+		}
+
+		e.typeIndex[t] = append(comps[:i], comps[i+1:]...)
+		return
+	}
+}
+
+// compTypeOf returns the type of T, and whether it can be looked up using the type index (i.e. is not an interface)
+func compTypeOf[T Comp]() (reflect.Type, bool) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	return t, t.Kind() != reflect.Interface
 }
 
 func HasComp[T Comp](e *CompContainer) bool {
 
+	if t, ok := compTypeOf[T](); ok {
+		return len(e.typeIndex[t]) > 0
+	}
+
 	for i := 0; i < len(e.Comps); i++ {
 
+		if e.Comps[i].base().isDestroyed {
+			continue
+		}
+
 		_, ok := e.Comps[i].(T)
 		if ok {
 			return true
@@ -45,10 +118,26 @@ func HasComp[T Comp](e *CompContainer) bool {
 	return false
 }
 
+// GetComp returns the first added component of type T, or the zero value if there is none.
+// Lookups of concrete types are O(1), while lookups of interface types go over all components
 func GetComp[T Comp](e *CompContainer) (out T) {
 
+	if t, ok := compTypeOf[T](); ok {
+
+		comps := e.typeIndex[t]
+		if len(comps) == 0 {
+			return out
+		}
+
+		return comps[0].(T)
+	}
+
 	for i := 0; i < len(e.Comps); i++ {
 
+		if e.Comps[i].base().isDestroyed {
+			continue
+		}
+
 		comp, ok := e.Comps[i].(T)
 		if ok {
 			return comp
@@ -58,16 +147,182 @@ func GetComp[T Comp](e *CompContainer) (out T) {
 	return out
 }
 
-// DestroyComp calls Destroy on the component and then removes it from the entities component list
-func DestroyComp[T Comp](e *CompContainer) {
+// GetComps returns all components of type T in the order they were added
+func GetComps[T Comp](e *CompContainer) []T {
+
+	if t, ok := compTypeOf[T](); ok {
+
+		comps := e.typeIndex[t]
+		out := make([]T, len(comps))
+		for i := 0; i < len(comps); i++ {
+			out[i] = comps[i].(T)
+		}
 
+		return out
+	}
+
+	out := make([]T, 0)
 	for i := 0; i < len(e.Comps); i++ {
 
+		if e.Comps[i].base().isDestroyed {
+			continue
+		}
+
 		comp, ok := e.Comps[i].(T)
 		if ok {
-			comp.Destroy()
+			out = append(out, comp)
+		}
+	}
+
+	return out
+}
+
+// SetCompEnabled enables/disables the component, calling OnEnable/OnDisable if the state changed.
+// Disabled components are not updated
+func SetCompEnabled(c Comp, enabled bool) {
+
+	b := c.base()
+	if b.isDestroyed || b.isDisabled == !enabled {
+		return
+	}
+
+	b.isDisabled = !enabled
+	if enabled {
+		c.OnEnable()
+	} else {
+		c.OnDisable()
+	}
+}
+
+// UpdateComps calls Update on all enabled components in order, calling Start first for components that haven't started.
+//
+// Components destroyed during the update (e.g. by another component) are not updated, and are removed once all components are updated
+func UpdateComps(e *CompContainer) {
+
+	assert.T(!e.isUpdating, "UpdateComps can not be called while the same container is being updated")
+
+	e.isUpdating = true
+
+	// Components added during the update are only updated starting next frame
+	compCount := len(e.Comps)
+	for i := 0; i < compCount; i++ {
+
+		c := e.Comps[i]
+		b := c.base()
+		if b.isDestroyed || b.isDisabled {
+			continue
+		}
+
+		if !b.isStarted {
+			b.isStarted = true
+			c.Start()
+
+			// Start might have disabled or destroyed this component
+			if b.isDestroyed || b.isDisabled {
+				continue
+			}
+		}
+
+		c.Update()
+	}
+
+	e.isUpdating = false
+
+	if e.hasDestroyed {
+		e.removeDestroyed()
+	}
+}
+
+func (e *CompContainer) removeDestroyed() {
+
+	alive := e.Comps[:0]
+	for i := 0; i < len(e.Comps); i++ {
+		if !e.Comps[i].base().isDestroyed {
+			alive = append(alive, e.Comps[i])
+		}
+	}
+
+	// Clear the tail so removed components can be garbage collected
+	for i := len(alive); i < len(e.Comps); i++ {
+		e.Comps[i] = nil
+	}
+
+	e.Comps = alive
+	e.hasDestroyed = false
+}
+
+// DestroyComp destroys the first added component of type T. See DestroyCompInstance for details
+func DestroyComp[T Comp](e *CompContainer) {
+
+	if t, ok := compTypeOf[T](); ok {
+
+		comps := e.typeIndex[t]
+		if len(comps) > 0 {
+			DestroyCompInstance(e, comps[0])
+		}
+
+		return
+	}
+
+	for i := 0; i < len(e.Comps); i++ {
+
+		if e.Comps[i].base().isDestroyed {
+			continue
+		}
+
+		if _, ok := e.Comps[i].(T); ok {
+			DestroyCompInstance(e, e.Comps[i])
+			return
+		}
+	}
+}
+
+// DestroyCompInstance calls OnDisable (if enabled) and Destroy on the component and then removes it from the entities component list.
+//
+// It is safe to call this from within a component update, in which case the component is removed after all components are updated
+func DestroyCompInstance(e *CompContainer, c Comp) {
+
+	b := c.base()
+	if b.isDestroyed {
+		return
+	}
+
+	if !b.isDisabled {
+		c.OnDisable()
+	}
+
+	b.isDestroyed = true
+	e.removeFromIndex(c)
+	c.Destroy()
+
+	// Unsubscribe removes from b.subscriptions, so iterate a detached copy
+	subs := b.subscriptions
+	b.subscriptions = nil
+	for _, sub := range subs {
+		sub.Unsubscribe()
+	}
+
+	if e.isUpdating {
+		e.hasDestroyed = true
+		return
+	}
+
+	for i := 0; i < len(e.Comps); i++ {
+
+		if e.Comps[i] == c {
 			e.Comps = append(e.Comps[:i], e.Comps[i+1:]...)
 			return
 		}
 	}
 }
+
+// IsUpdating reports whether UpdateComps is running on this container
+func (e *CompContainer) IsUpdating() bool {
+	return e.isUpdating
+}
+
+// IsCompAlive reports whether the component has not been destroyed.
+// Destroyed components might still be in CompContainer.Comps until the container finishes updating
+func IsCompAlive(c Comp) bool {
+	return !c.base().isDestroyed
+}
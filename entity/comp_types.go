@@ -0,0 +1,283 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/registry"
+)
+
+var (
+	ErrUnknownCompType = errors.New("unknown component type")
+
+	compTypesByName = make(map[string]*CompTypeInfo)
+	compTypesByType = make(map[reflect.Type]*CompTypeInfo)
+)
+
+// CompFieldInfo describes a serialized field of a component
+type CompFieldInfo struct {
+	// Name is the Go name of the field and JsonName is the name used when serializing
+	Name     string
+	JsonName string
+	Type     reflect.Type
+
+	// Index is used with reflect.Value.FieldByIndex
+	Index []int
+}
+
+// CompTypeInfo is the registered info of a component type
+type CompTypeInfo struct {
+	// Name is the stable name the component type is registered and serialized under.
+	// It should not change, otherwise serialized components of this type can't be loaded
+	Name string
+
+	// Type is the struct type of the component (i.e. not a pointer)
+	Type    reflect.Type
+	Factory func() Comp
+	Fields  []CompFieldInfo
+}
+
+// RegisterCompType registers component type T under the passed name. Components are expected to be used as pointers, so
+// T should be the struct type and *T should implement Comp.
+//
+// Example: entity.RegisterCompType[TransformComp]("Transform")
+func RegisterCompType[T any, PT interface {
+	*T
+	Comp
+}](name string) *CompTypeInfo {
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+
+	assert.T(name != "", "Component type name can not be empty")
+	assert.T(t.Kind() == reflect.Struct, "Component type '%s' must be a struct, but got kind '%s'", t.String(), t.Kind().String())
+	assert.T(compTypesByName[name] == nil, "Component type name '%s' is already registered", name)
+	assert.T(compTypesByType[t] == nil, "Component type '%s' is already registered", t.String())
+
+	info := &CompTypeInfo{
+		Name: name,
+		Type: t,
+		Factory: func() Comp {
+			return PT(new(T))
+		},
+		Fields: collectCompFields(t, nil),
+	}
+
+	compTypesByName[name] = info
+	compTypesByType[t] = info
+	return info
+}
+
+// collectCompFields returns all the fields serialized by encoding/json, excluding BaseComp
+func collectCompFields(t reflect.Type, parentIndex []int) []CompFieldInfo {
+
+	baseCompType := reflect.TypeOf(BaseComp{})
+
+	fields := make([]CompFieldInfo, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+
+		f := t.Field(i)
+		if f.Type == baseCompType {
+			continue
+		}
+
+		index := append(append([]int{}, parentIndex...), i)
+
+		// Fields of embedded structs are serialized as if they were part of the parent
+		if f.Anonymous && f.Type.Kind() == reflect.Struct && f.Tag.Get("json") == "" {
+			fields = append(fields, collectCompFields(f.Type, index)...)
+			continue
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+
+		jsonName := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+
+			if tagName != "" {
+				jsonName = tagName
+			}
+		}
+
+		fields = append(fields, CompFieldInfo{
+			Name:     f.Name,
+			JsonName: jsonName,
+			Type:     f.Type,
+			Index:    index,
+		})
+	}
+
+	return fields
+}
+
+func GetCompTypeInfo(name string) (*CompTypeInfo, bool) {
+	info, ok := compTypesByName[name]
+	return info, ok
+}
+
+// GetCompTypeInfoOf returns the type info of the component, which is expected to be a pointer to a registered type
+func GetCompTypeInfoOf(c Comp) (*CompTypeInfo, bool) {
+
+	t := reflect.TypeOf(c)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	info, ok := compTypesByType[t]
+	return info, ok
+}
+
+// NewCompByName creates a zero value component of the type registered under name
+func NewCompByName(name string) (Comp, error) {
+
+	info, ok := compTypesByName[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownCompType, name)
+	}
+
+	return info.Factory(), nil
+}
+
+type compJson struct {
+	Type    string          `json:"type"`
+	Enabled bool            `json:"enabled"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// UnmarshalJSON treats a missing 'enabled' key as enabled, so hand written files don't load disabled components
+func (cj *compJson) UnmarshalJSON(data []byte) error {
+
+	// The alias type has no methods, which avoids infinite recursion
+	type compJsonNoMethods compJson
+
+	cjNoMethods := compJsonNoMethods{Enabled: true}
+	err := json.Unmarshal(data, &cjNoMethods)
+	if err != nil {
+		return err
+	}
+
+	*cj = compJson(cjNoMethods)
+	return nil
+}
+
+type compContainerJson struct {
+	Comps []compJson `json:"comps"`
+}
+
+// MarshalComp returns the JSON of a single component. The component type must be registered
+func MarshalComp(c Comp) ([]byte, error) {
+
+	cj, err := newCompJson(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(cj)
+}
+
+func newCompJson(c Comp) (compJson, error) {
+
+	info, ok := GetCompTypeInfoOf(c)
+	if !ok {
+		return compJson{}, fmt.Errorf("%w: '%T' is not registered", ErrUnknownCompType, c)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return compJson{}, fmt.Errorf("failed to marshal component of type '%s'. Err: %w", info.Name, err)
+	}
+
+	return compJson{
+		Type:    info.Name,
+		Enabled: c.IsEnabled(),
+		Data:    data,
+	}, nil
+}
+
+// UnmarshalComp creates a component from JSON produced by MarshalComp. The returned component is not yet added to any container
+func UnmarshalComp(data []byte) (Comp, error) {
+
+	cj := compJson{}
+	err := json.Unmarshal(data, &cj)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalCompJson(&cj)
+}
+
+func unmarshalCompJson(cj *compJson) (Comp, error) {
+
+	c, err := NewCompByName(cj.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cj.Data) > 0 {
+		err = json.Unmarshal(cj.Data, c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal component of type '%s'. Err: %w", cj.Type, err)
+		}
+	}
+
+	c.base().isDisabled = !cj.Enabled
+	return c, nil
+}
+
+// MarshalCompContainer returns the JSON of all components in the container. All component types must be registered
+func MarshalCompContainer(cc *CompContainer) ([]byte, error) {
+
+	ccj := compContainerJson{
+		Comps: make([]compJson, 0, len(cc.Comps)),
+	}
+
+	for i := 0; i < len(cc.Comps); i++ {
+
+		if cc.Comps[i].base().isDestroyed {
+			continue
+		}
+
+		cj, err := newCompJson(cc.Comps[i])
+		if err != nil {
+			return nil, err
+		}
+
+		ccj.Comps = append(ccj.Comps, cj)
+	}
+
+	return json.MarshalIndent(ccj, "", "\t")
+}
+
+// UnmarshalCompContainer creates a container from JSON produced by MarshalCompContainer, and adds
+// all components to it for the passed entity (i.e. Init and OnEnable are called)
+func UnmarshalCompContainer(data []byte, entityHandle registry.Handle) (CompContainer, error) {
+
+	ccj := compContainerJson{}
+	err := json.Unmarshal(data, &ccj)
+	if err != nil {
+		return CompContainer{}, err
+	}
+
+	cc := NewCompContainer()
+	for i := 0; i < len(ccj.Comps); i++ {
+
+		c, err := unmarshalCompJson(&ccj.Comps[i])
+		if err != nil {
+			return CompContainer{}, err
+		}
+
+		addComp(entityHandle, &cc, c)
+	}
+
+	return cc, nil
+}
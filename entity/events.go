@@ -0,0 +1,187 @@
+package entity
+
+import (
+	"reflect"
+
+	"github.com/bloeys/nmage/registry"
+)
+
+// Subscription is returned by Subscribe and can be used to stop receiving events
+type Subscription struct {
+	bus       *EventBus
+	eventType reflect.Type
+	owner     Comp
+	handler   any
+	isRemoved bool
+}
+
+// Unsubscribe stops the handler from receiving events. If an event of this type is being dispatched then
+// the subscription is removed once the dispatch is done, otherwise it is removed immediately
+func (s *Subscription) Unsubscribe() {
+
+	if s.isRemoved {
+		return
+	}
+	s.isRemoved = true
+
+	if s.owner != nil {
+		b := s.owner.base()
+		for i := 0; i < len(b.subscriptions); i++ {
+			if b.subscriptions[i] == s {
+				b.subscriptions = append(b.subscriptions[:i], b.subscriptions[i+1:]...)
+				break
+			}
+		}
+	}
+
+	state := s.bus.dispatchStates[s.eventType]
+	if state != nil && state.depth > 0 {
+		state.hasRemoved = true
+		return
+	}
+
+	s.bus.removeUnsubscribed(s.eventType)
+}
+
+// EventBus delivers typed events to subscribers, either immediately or queued until FlushQueued is called (e.g. at end of frame).
+//
+// Subscriptions owned by a component are removed automatically when the component is destroyed using DestroyComp.
+//
+// It is NOT safe to use an event bus concurrently
+type EventBus struct {
+	subs   map[reflect.Type][]*Subscription
+	queued []func()
+
+	// dispatchStates tracks running dispatches per event type, since handlers can dispatch the same event type again
+	dispatchStates map[reflect.Type]*dispatchState
+}
+
+type dispatchState struct {
+	depth      int
+	hasRemoved bool
+}
+
+// Subscribe registers handler to receive events of type T.
+//
+// If owner is not nil then the subscription receives events sent to the owner entity as well as broadcasts,
+// and is removed when the owner is destroyed. Subscriptions without an owner only receive broadcasts
+func Subscribe[T any](bus *EventBus, owner Comp, handler func(ev *T)) *Subscription {
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	sub := &Subscription{
+		bus:       bus,
+		eventType: t,
+		owner:     owner,
+		handler:   handler,
+	}
+
+	bus.subs[t] = append(bus.subs[t], sub)
+
+	if owner != nil {
+		b := owner.base()
+		b.subscriptions = append(b.subscriptions, sub)
+	}
+
+	return sub
+}
+
+// Send delivers the event immediately to all subscribers owned by a component of the target entity
+func Send[T any](bus *EventBus, target registry.Handle, ev T) {
+	dispatch(bus, target, false, &ev)
+}
+
+// Broadcast delivers the event immediately to all subscribers of this event type
+func Broadcast[T any](bus *EventBus, ev T) {
+	dispatch(bus, 0, true, &ev)
+}
+
+// SendQueued is like Send but the event is only delivered on the next FlushQueued
+func SendQueued[T any](bus *EventBus, target registry.Handle, ev T) {
+	bus.queued = append(bus.queued, func() {
+		dispatch(bus, target, false, &ev)
+	})
+}
+
+// BroadcastQueued is like Broadcast but the event is only delivered on the next FlushQueued
+func BroadcastQueued[T any](bus *EventBus, ev T) {
+	bus.queued = append(bus.queued, func() {
+		dispatch(bus, 0, true, &ev)
+	})
+}
+
+func dispatch[T any](bus *EventBus, target registry.Handle, isBroadcast bool, ev *T) {
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	subs := bus.subs[t]
+
+	state := bus.dispatchStates[t]
+	if state == nil {
+		state = &dispatchState{}
+		bus.dispatchStates[t] = state
+	}
+
+	// Removed subscriptions are only compacted once the outermost dispatch of this type is done,
+	// because compacting moves subscriptions under the loops of the outer dispatches
+	state.depth++
+	defer func() {
+		state.depth--
+		if state.depth == 0 && state.hasRemoved {
+			state.hasRemoved = false
+			bus.removeUnsubscribed(t)
+		}
+	}()
+
+	// Subscriptions added by handlers only receive the next event
+	subCount := len(subs)
+	for i := 0; i < subCount; i++ {
+
+		sub := subs[i]
+		if sub.isRemoved {
+			state.hasRemoved = true
+			continue
+		}
+
+		if !isBroadcast && (sub.owner == nil || sub.owner.base().Handle != target) {
+			continue
+		}
+
+		sub.handler.(func(*T))(ev)
+	}
+}
+
+func (bus *EventBus) removeUnsubscribed(t reflect.Type) {
+
+	subs := bus.subs[t]
+	alive := subs[:0]
+	for i := 0; i < len(subs); i++ {
+		if !subs[i].isRemoved {
+			alive = append(alive, subs[i])
+		}
+	}
+
+	for i := len(alive); i < len(subs); i++ {
+		subs[i] = nil
+	}
+
+	bus.subs[t] = alive
+}
+
+// FlushQueued delivers all queued events in the order they were queued.
+// Events queued while flushing are delivered in the same flush
+func (bus *EventBus) FlushQueued() {
+
+	for i := 0; i < len(bus.queued); i++ {
+		bus.queued[i]()
+		bus.queued[i] = nil
+	}
+
+	bus.queued = bus.queued[:0]
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs:           make(map[reflect.Type][]*Subscription),
+		queued:         make([]func(), 0),
+		dispatchStates: make(map[reflect.Type]*dispatchState),
+	}
+}
@@ -0,0 +1,98 @@
+package entity
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bloeys/gglm/gglm"
+)
+
+type testEvent struct {
+	Depth int
+}
+
+func TestEventBusNestedDispatchWithUnsubscribe(t *testing.T) {
+
+	bus := NewEventBus()
+
+	var subB *Subscription
+	aCount, bCount, cCount := 0, 0, 0
+
+	Subscribe(bus, nil, func(ev *testEvent) {
+
+		aCount++
+		if ev.Depth > 0 {
+			return
+		}
+
+		subB.Unsubscribe()
+		Broadcast(bus, testEvent{Depth: ev.Depth + 1})
+	})
+
+	subB = Subscribe(bus, nil, func(ev *testEvent) {
+		bCount++
+	})
+
+	Subscribe(bus, nil, func(ev *testEvent) {
+		cCount++
+	})
+
+	Broadcast(bus, testEvent{})
+
+	if aCount != 2 || bCount != 0 || cCount != 2 {
+		t.Fatalf("Expected handler counts a=2, b=0, c=2, but got a=%d, b=%d, c=%d", aCount, bCount, cCount)
+	}
+
+	if len(bus.subs[reflect.TypeOf(testEvent{})]) != 2 {
+		t.Fatalf("Expected unsubscribed handler to be removed once dispatching is done, but have %d subscriptions", len(bus.subs[reflect.TypeOf(testEvent{})]))
+	}
+
+	Broadcast(bus, testEvent{Depth: 1})
+	if aCount != 3 || bCount != 0 || cCount != 3 {
+		t.Fatalf("Expected handler counts a=3, b=0, c=3, but got a=%d, b=%d, c=%d", aCount, bCount, cCount)
+	}
+}
+
+func TestEventBusUnsubscribeWithoutDispatch(t *testing.T) {
+
+	bus := NewEventBus()
+	evType := reflect.TypeOf(testEvent{})
+	owner := NewTransformComp(gglm.NewVec3(0, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+
+	order := make([]string, 0, 4)
+	subscribe := func(owner Comp, name string) *Subscription {
+		return Subscribe(bus, owner, func(ev *testEvent) {
+			order = append(order, name)
+		})
+	}
+
+	subscribe(nil, "a")
+	subB := subscribe(nil, "b")
+	subscribe(nil, "c")
+	subD := subscribe(owner, "d")
+
+	subB.Unsubscribe()
+	if len(bus.subs[evType]) != 3 {
+		t.Fatalf("Expected unsubscribed handler to be removed immediately when not dispatching, but have %d subscriptions", len(bus.subs[evType]))
+	}
+
+	// Unsubscribing again must not remove anything else
+	subB.Unsubscribe()
+	if len(bus.subs[evType]) != 3 {
+		t.Fatalf("Expected unsubscribing twice to do nothing, but have %d subscriptions", len(bus.subs[evType]))
+	}
+
+	subD.Unsubscribe()
+	if len(bus.subs[evType]) != 2 {
+		t.Fatalf("Expected owned handler to be removed immediately when not dispatching, but have %d subscriptions", len(bus.subs[evType]))
+	}
+
+	if len(owner.base().subscriptions) != 0 {
+		t.Fatalf("Expected unsubscribed handler to be removed from its owner, but owner has %d subscriptions", len(owner.base().subscriptions))
+	}
+
+	Broadcast(bus, testEvent{})
+	if !reflect.DeepEqual(order, []string{"a", "c"}) {
+		t.Fatalf("Expected remaining handlers to be called in subscription order [a c], but got %v", order)
+	}
+}
@@ -0,0 +1,526 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/registry"
+)
+
+var (
+	ErrUnknownCompField = errors.New("unknown component field")
+	ErrPrefabCompExists = errors.New("prefab already has a component of this unique type")
+)
+
+// DirtyMarker is implemented by components that cache values derived from their fields (e.g. TransformComp).
+// MarkDirty is called whenever a prefab changes a field of the component, since fields are set by reflection
+type DirtyMarker interface {
+	MarkDirty()
+}
+
+// PrefabComp is a component stored in a prefab, with each serialized field stored separately
+// so that fields can be overridden individually by instances.
+//
+// A prefab can have multiple components of the same type, in which case they are identified by a PrefabCompKey
+type PrefabComp struct {
+	Type    string                     `json:"type"`
+	Enabled bool                       `json:"enabled"`
+	Fields  map[string]json.RawMessage `json:"fields"`
+}
+
+// UnmarshalJSON treats a missing 'enabled' key as enabled, so hand written files don't load disabled components
+func (pc *PrefabComp) UnmarshalJSON(data []byte) error {
+
+	// The alias type has no methods, which avoids infinite recursion
+	type prefabCompNoMethods PrefabComp
+
+	pcNoMethods := prefabCompNoMethods{Enabled: true}
+	err := json.Unmarshal(data, &pcNoMethods)
+	if err != nil {
+		return err
+	}
+
+	*pc = PrefabComp(pcNoMethods)
+	return nil
+}
+
+// PrefabCompKey identifies a component of a prefab or instance by its type name and its index among the components of that type,
+// e.g. {"Collider", 1} is the second collider
+type PrefabCompKey struct {
+	Type  string
+	Index int
+}
+
+// Prefab is a reusable entity template. Instances created using InstantiatePrefab are tracked by the prefab,
+// and changes made using the prefab methods are propagated to all instances that haven't overridden the changed fields
+type Prefab struct {
+	Name  string       `json:"name"`
+	Comps []PrefabComp `json:"comps"`
+
+	Instances []*PrefabInstance `json:"-"`
+}
+
+// PrefabInstance is an entity created from a prefab
+type PrefabInstance struct {
+	Prefab *Prefab
+	Handle registry.Handle
+	Comps  CompContainer
+
+	// Overrides maps a component to the json names of its fields that
+	// this instance overrides, and so are not changed when the prefab changes
+	Overrides map[PrefabCompKey]map[string]bool
+}
+
+func NewPrefab(name string) *Prefab {
+
+	assert.T(name != "", "Prefab name can not be empty")
+	return &Prefab{
+		Name:      name,
+		Comps:     make([]PrefabComp, 0),
+		Instances: make([]*PrefabInstance, 0),
+	}
+}
+
+// NewPrefabFromComps creates a prefab from the current state of the passed components. All component types must be registered
+func NewPrefabFromComps(name string, cc *CompContainer) (*Prefab, error) {
+
+	p := NewPrefab(name)
+	for i := 0; i < len(cc.Comps); i++ {
+
+		if cc.Comps[i].base().isDestroyed {
+			continue
+		}
+
+		err := p.AddComp(cc.Comps[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// PrefabFromJson loads a prefab asset produced by Prefab.ToJson
+func PrefabFromJson(data []byte) (*Prefab, error) {
+
+	p := &Prefab{}
+	err := json.Unmarshal(data, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Name == "" {
+		return nil, errors.New("prefab name can not be empty")
+	}
+
+	for i := 0; i < len(p.Comps); i++ {
+		if _, ok := GetCompTypeInfo(p.Comps[i].Type); !ok {
+			return nil, fmt.Errorf("%w: '%s' in prefab '%s'", ErrUnknownCompType, p.Comps[i].Type, p.Name)
+		}
+	}
+
+	p.Instances = make([]*PrefabInstance, 0)
+	return p, nil
+}
+
+func (p *Prefab) ToJson() ([]byte, error) {
+	return json.MarshalIndent(p, "", "\t")
+}
+
+// AddComp adds the current state of the component to the prefab after any components of the same type,
+// and adds a copy of it to all instances that don't have a component at that key
+func (p *Prefab) AddComp(c Comp) error {
+
+	info, ok := GetCompTypeInfoOf(c)
+	if !ok {
+		return fmt.Errorf("%w: '%T' is not registered", ErrUnknownCompType, c)
+	}
+
+	key := PrefabCompKey{Type: info.Name, Index: p.compCountOfType(info.Name)}
+	if c.IsUnique() && key.Index > 0 {
+		return fmt.Errorf("%w: '%s'", ErrPrefabCompExists, info.Name)
+	}
+
+	pc := PrefabComp{
+		Type:    info.Name,
+		Enabled: c.IsEnabled(),
+		Fields:  make(map[string]json.RawMessage, len(info.Fields)),
+	}
+
+	compVal := reflect.ValueOf(c).Elem()
+	for _, f := range info.Fields {
+
+		data, err := json.Marshal(compVal.FieldByIndex(f.Index).Interface())
+		if err != nil {
+			return fmt.Errorf("failed to marshal field '%s' of component '%s'. Err: %w", f.Name, info.Name, err)
+		}
+
+		pc.Fields[f.JsonName] = data
+	}
+
+	p.Comps = append(p.Comps, pc)
+
+	for _, inst := range p.Instances {
+
+		if findCompByKey(&inst.Comps, key) != nil {
+			continue
+		}
+
+		newComp, err := pc.newComp()
+		if err != nil {
+			return err
+		}
+
+		addComp(inst.Handle, &inst.Comps, newComp)
+	}
+
+	return nil
+}
+
+// SetField changes a field of a prefab component, and updates the field in all instances that don't override it.
+// The value is anything that encodes to valid JSON for the field
+func (p *Prefab) SetField(key PrefabCompKey, jsonFieldName string, value any) error {
+
+	pc := p.getComp(key)
+	if pc == nil {
+		return fmt.Errorf("%w: prefab '%s' has no component '%s' with index %d", ErrUnknownCompType, p.Name, key.Type, key.Index)
+	}
+
+	if _, ok := pc.Fields[jsonFieldName]; !ok {
+		return fmt.Errorf("%w: '%s' in component '%s'", ErrUnknownCompField, jsonFieldName, key.Type)
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	pc.Fields[jsonFieldName] = data
+
+	for _, inst := range p.Instances {
+
+		if inst.IsOverridden(key, jsonFieldName) {
+			continue
+		}
+
+		c := findCompByKey(&inst.Comps, key)
+		if c == nil {
+			continue
+		}
+
+		err = setCompField(c, jsonFieldName, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PropagateToInstances applies all prefab fields to all instances, except fields overridden by each instance.
+// This is useful after loading a changed prefab asset or after changing Prefab.Comps directly
+func (p *Prefab) PropagateToInstances() error {
+
+	for _, inst := range p.Instances {
+
+		err := p.applyToInstance(inst)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Prefab) applyToInstance(inst *PrefabInstance) error {
+
+	for i := 0; i < len(p.Comps); i++ {
+
+		pc := &p.Comps[i]
+		key := p.keyOf(i)
+		c := findCompByKey(&inst.Comps, key)
+		if c == nil {
+
+			newComp, err := pc.newComp()
+			if err != nil {
+				return err
+			}
+
+			addComp(inst.Handle, &inst.Comps, newComp)
+			continue
+		}
+
+		for name, data := range pc.Fields {
+
+			if inst.IsOverridden(key, name) {
+				continue
+			}
+
+			err := setCompField(c, name, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *Prefab) getComp(key PrefabCompKey) *PrefabComp {
+
+	index := 0
+	for i := 0; i < len(p.Comps); i++ {
+
+		if p.Comps[i].Type != key.Type {
+			continue
+		}
+
+		if index == key.Index {
+			return &p.Comps[i]
+		}
+		index++
+	}
+
+	return nil
+}
+
+// keyOf returns the key of the prefab component at index i of Comps
+func (p *Prefab) keyOf(i int) PrefabCompKey {
+
+	key := PrefabCompKey{Type: p.Comps[i].Type}
+	for j := 0; j < i; j++ {
+		if p.Comps[j].Type == key.Type {
+			key.Index++
+		}
+	}
+
+	return key
+}
+
+func (p *Prefab) compCountOfType(compType string) int {
+
+	count := 0
+	for i := 0; i < len(p.Comps); i++ {
+		if p.Comps[i].Type == compType {
+			count++
+		}
+	}
+
+	return count
+}
+
+// RemoveInstance stops tracking the instance, so it is no longer affected by prefab changes.
+// The instance entity and its components are not changed
+func (p *Prefab) RemoveInstance(inst *PrefabInstance) {
+
+	for i := 0; i < len(p.Instances); i++ {
+
+		if p.Instances[i] != inst {
+			continue
+		}
+
+		p.Instances = append(p.Instances[:i], p.Instances[i+1:]...)
+		inst.Prefab = nil
+		return
+	}
+}
+
+func (pc *PrefabComp) newComp() (Comp, error) {
+
+	c, err := NewCompByName(pc.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, data := range pc.Fields {
+
+		err = setCompField(c, name, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.base().isDisabled = !pc.Enabled
+	return c, nil
+}
+
+// InstantiatePrefab creates a new entity in the registry and adds copies of all prefab components to it
+func InstantiatePrefab[T any](p *Prefab, r *registry.Registry[T]) (*PrefabInstance, error) {
+
+	comps := make([]Comp, 0, len(p.Comps))
+	for i := 0; i < len(p.Comps); i++ {
+
+		c, err := p.Comps[i].newComp()
+		if err != nil {
+			return nil, err
+		}
+
+		comps = append(comps, c)
+	}
+
+	_, handle, err := r.New()
+	if err != nil {
+		return nil, err
+	}
+
+	inst := &PrefabInstance{
+		Prefab:    p,
+		Handle:    handle,
+		Comps:     NewCompContainer(),
+		Overrides: make(map[PrefabCompKey]map[string]bool),
+	}
+
+	for i := 0; i < len(comps); i++ {
+		addComp(handle, &inst.Comps, comps[i])
+	}
+
+	p.Instances = append(p.Instances, inst)
+	return inst, nil
+}
+
+// SetOverride marks the field as overridden, so prefab changes to it are not applied to this instance
+func (inst *PrefabInstance) SetOverride(key PrefabCompKey, jsonFieldName string) {
+
+	fields := inst.Overrides[key]
+	if fields == nil {
+		fields = make(map[string]bool)
+		inst.Overrides[key] = fields
+	}
+
+	fields[jsonFieldName] = true
+}
+
+// ClearOverride removes the override and resets the field to the prefab value
+func (inst *PrefabInstance) ClearOverride(key PrefabCompKey, jsonFieldName string) error {
+
+	delete(inst.Overrides[key], jsonFieldName)
+
+	if inst.Prefab == nil {
+		return nil
+	}
+
+	pc := inst.Prefab.getComp(key)
+	c := findCompByKey(&inst.Comps, key)
+	if pc == nil || c == nil {
+		return nil
+	}
+
+	data, ok := pc.Fields[jsonFieldName]
+	if !ok {
+		return nil
+	}
+
+	return setCompField(c, jsonFieldName, data)
+}
+
+func (inst *PrefabInstance) IsOverridden(key PrefabCompKey, jsonFieldName string) bool {
+	return inst.Overrides[key][jsonFieldName]
+}
+
+// DetectOverrides marks every field whose value differs from the prefab as overridden.
+// This is useful after an instance was edited directly (e.g. in an editor)
+func (inst *PrefabInstance) DetectOverrides() error {
+
+	if inst.Prefab == nil {
+		return nil
+	}
+
+	for i := 0; i < len(inst.Prefab.Comps); i++ {
+
+		pc := &inst.Prefab.Comps[i]
+		key := inst.Prefab.keyOf(i)
+		c := findCompByKey(&inst.Comps, key)
+		if c == nil {
+			continue
+		}
+
+		info, _ := GetCompTypeInfoOf(c)
+		compVal := reflect.ValueOf(c).Elem()
+		for _, f := range info.Fields {
+
+			data, err := json.Marshal(compVal.FieldByIndex(f.Index).Interface())
+			if err != nil {
+				return err
+			}
+
+			if prefabData, ok := pc.Fields[f.JsonName]; ok && !jsonEqual(data, prefabData) {
+				inst.SetOverride(key, f.JsonName)
+			}
+		}
+	}
+
+	return nil
+}
+
+func jsonEqual(a, b []byte) bool {
+
+	var aVal, bVal any
+	if json.Unmarshal(a, &aVal) != nil || json.Unmarshal(b, &bVal) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(aVal, bVal)
+}
+
+// findCompByKey returns the alive component at the key, where the index counts alive components of the type in add order
+func findCompByKey(cc *CompContainer, key PrefabCompKey) Comp {
+
+	index := 0
+	for i := 0; i < len(cc.Comps); i++ {
+
+		c := cc.Comps[i]
+		if c.base().isDestroyed {
+			continue
+		}
+
+		info, ok := GetCompTypeInfoOf(c)
+		if !ok || info.Name != key.Type {
+			continue
+		}
+
+		if index == key.Index {
+			return c
+		}
+		index++
+	}
+
+	return nil
+}
+
+// setCompField decodes the JSON into the field with the passed json name, and marks the component dirty if it is a DirtyMarker.
+// All prefab writes (SetField, ClearOverride, PropagateToInstances etc.) go through this
+func setCompField(c Comp, jsonFieldName string, data []byte) error {
+
+	info, ok := GetCompTypeInfoOf(c)
+	if !ok {
+		return fmt.Errorf("%w: '%T' is not registered", ErrUnknownCompType, c)
+	}
+
+	for _, f := range info.Fields {
+
+		if f.JsonName != jsonFieldName {
+			continue
+		}
+
+		fieldVal := reflect.ValueOf(c).Elem().FieldByIndex(f.Index)
+
+		// Decode into a fresh value so that pointer fields aren't shared between instances
+		newVal := reflect.New(f.Type)
+		err := json.Unmarshal(data, newVal.Interface())
+		if err != nil {
+			return fmt.Errorf("failed to set field '%s' of component '%s'. Err: %w", f.Name, info.Name, err)
+		}
+
+		fieldVal.Set(newVal.Elem())
+		if dm, ok := c.(DirtyMarker); ok {
+			dm.MarkDirty()
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%w: '%s' in component '%s'", ErrUnknownCompField, jsonFieldName, info.Name)
+}
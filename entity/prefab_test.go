@@ -0,0 +1,239 @@
+package entity
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nmage/registry"
+)
+
+func TestPrefabFieldChangesMarkTransformDirty(t *testing.T) {
+
+	cc := NewCompContainer()
+	AddComp(0, &cc, NewTransformComp(gglm.NewVec3(1, 2, 3), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1)))
+
+	p, err := NewPrefabFromComps("test", &cc)
+	if err != nil {
+		t.Fatalf("Failed to create prefab. Err: %v", err)
+	}
+
+	r := registry.NewRegistry[int](4)
+	inst, err := InstantiatePrefab(p, r)
+	if err != nil {
+		t.Fatalf("Failed to instantiate prefab. Err: %v", err)
+	}
+
+	transformKey := PrefabCompKey{Type: "Transform"}
+	tr := GetComp[*TransformComp](&inst.Comps)
+	checkWorldPos := func(step string, expected *gglm.Vec3) {
+		if got := tr.WorldPos(); !got.Eq(expected) {
+			t.Fatalf("%s: expected world pos %v, but got %v", step, expected.String(), got.String())
+		}
+	}
+
+	// Cache the world matrix so that a missing MarkDirty shows up as a stale position
+	checkWorldPos("instantiate", gglm.NewVec3(1, 2, 3))
+
+	err = p.SetField(transformKey, "Pos", gglm.NewVec3(4, 5, 6))
+	if err != nil {
+		t.Fatalf("Failed to set prefab field. Err: %v", err)
+	}
+	checkWorldPos("SetField", gglm.NewVec3(4, 5, 6))
+
+	tr.SetPos(gglm.NewVec3(7, 8, 9))
+	inst.SetOverride(transformKey, "Pos")
+	checkWorldPos("override", gglm.NewVec3(7, 8, 9))
+
+	err = inst.ClearOverride(transformKey, "Pos")
+	if err != nil {
+		t.Fatalf("Failed to clear override. Err: %v", err)
+	}
+	checkWorldPos("ClearOverride", gglm.NewVec3(4, 5, 6))
+
+	pc := p.getComp(transformKey)
+	pc.Fields["Pos"] = []byte(`{"Data":[10,11,12]}`)
+	err = p.PropagateToInstances()
+	if err != nil {
+		t.Fatalf("Failed to propagate to instances. Err: %v", err)
+	}
+	checkWorldPos("PropagateToInstances", gglm.NewVec3(10, 11, 12))
+}
+
+type testColliderComp struct {
+	BaseComp
+
+	Radius    float32
+	IsTrigger bool
+}
+
+func init() {
+	RegisterCompType[testColliderComp]("TestCollider")
+}
+
+func TestPrefabMultipleCompsOfSameType(t *testing.T) {
+
+	cc := NewCompContainer()
+	AddComp(0, &cc, NewTransformComp(gglm.NewVec3(0, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1)))
+	AddComp(0, &cc, &testColliderComp{Radius: 1})
+	AddComp(0, &cc, &testColliderComp{Radius: 2, IsTrigger: true})
+
+	p, err := NewPrefabFromComps("multi", &cc)
+	if err != nil {
+		t.Fatalf("Failed to create prefab from an entity with two colliders. Err: %v", err)
+	}
+
+	if len(p.Comps) != 3 {
+		t.Fatalf("Expected 3 prefab components, but got %d", len(p.Comps))
+	}
+
+	// Unique types still can't be added twice
+	err = p.AddComp(NewTransformComp(gglm.NewVec3(0, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1)))
+	if !errors.Is(err, ErrPrefabCompExists) {
+		t.Fatalf("Expected ErrPrefabCompExists when adding a second transform, but got %v", err)
+	}
+
+	r := registry.NewRegistry[int](4)
+	inst, err := InstantiatePrefab(p, r)
+	if err != nil {
+		t.Fatalf("Failed to instantiate prefab. Err: %v", err)
+	}
+
+	colliders := GetComps[*testColliderComp](&inst.Comps)
+	if len(colliders) != 2 || colliders[0].Radius != 1 || colliders[1].Radius != 2 || !colliders[1].IsTrigger {
+		t.Fatalf("Expected instance to have both colliders with their values, but got %d colliders", len(colliders))
+	}
+
+	firstKey := PrefabCompKey{Type: "TestCollider", Index: 0}
+	secondKey := PrefabCompKey{Type: "TestCollider", Index: 1}
+
+	// Changing the second collider must not touch the first
+	err = p.SetField(secondKey, "Radius", 5)
+	if err != nil {
+		t.Fatalf("Failed to set field. Err: %v", err)
+	}
+
+	if colliders[0].Radius != 1 || colliders[1].Radius != 5 {
+		t.Fatalf("Expected radii 1 and 5, but got %v and %v", colliders[0].Radius, colliders[1].Radius)
+	}
+
+	// Overrides are per component, so overriding the first collider doesn't block changes to the second
+	colliders[0].Radius = 10
+	inst.SetOverride(firstKey, "Radius")
+
+	if err = p.SetField(firstKey, "Radius", 20); err != nil {
+		t.Fatalf("Failed to set field. Err: %v", err)
+	}
+
+	if err = p.SetField(secondKey, "Radius", 30); err != nil {
+		t.Fatalf("Failed to set field. Err: %v", err)
+	}
+
+	if colliders[0].Radius != 10 || colliders[1].Radius != 30 {
+		t.Fatalf("Expected radii 10 (overridden) and 30, but got %v and %v", colliders[0].Radius, colliders[1].Radius)
+	}
+
+	if inst.IsOverridden(secondKey, "Radius") {
+		t.Fatalf("Expected the override of the first collider to not apply to the second")
+	}
+
+	if err = p.SetField(PrefabCompKey{Type: "TestCollider", Index: 2}, "Radius", 1); !errors.Is(err, ErrUnknownCompType) {
+		t.Fatalf("Expected ErrUnknownCompType for a collider index that doesn't exist, but got %v", err)
+	}
+
+	// A third collider added to the prefab is added to the instance
+	err = p.AddComp(&testColliderComp{Radius: 3})
+	if err != nil {
+		t.Fatalf("Failed to add a third collider. Err: %v", err)
+	}
+
+	colliders = GetComps[*testColliderComp](&inst.Comps)
+	if len(colliders) != 3 || colliders[2].Radius != 3 {
+		t.Fatalf("Expected the instance to get the third collider, but got %d colliders", len(colliders))
+	}
+}
+
+func TestPrefabOverrides(t *testing.T) {
+
+	cc := NewCompContainer()
+	AddComp(0, &cc, &testColliderComp{Radius: 1})
+
+	p, err := NewPrefabFromComps("overrides", &cc)
+	if err != nil {
+		t.Fatalf("Failed to create prefab. Err: %v", err)
+	}
+
+	r := registry.NewRegistry[int](4)
+	plain, err := InstantiatePrefab(p, r)
+	if err != nil {
+		t.Fatalf("Failed to instantiate prefab. Err: %v", err)
+	}
+
+	overriding, err := InstantiatePrefab(p, r)
+	if err != nil {
+		t.Fatalf("Failed to instantiate prefab. Err: %v", err)
+	}
+
+	key := PrefabCompKey{Type: "TestCollider"}
+	plainCollider := GetComp[*testColliderComp](&plain.Comps)
+	overridingCollider := GetComp[*testColliderComp](&overriding.Comps)
+
+	overridingCollider.Radius = 7
+	overriding.SetOverride(key, "Radius")
+
+	// SetField reaches instances, except for fields they override
+	if err = p.SetField(key, "Radius", 2); err != nil {
+		t.Fatalf("Failed to set field. Err: %v", err)
+	}
+
+	if err = p.SetField(key, "IsTrigger", true); err != nil {
+		t.Fatalf("Failed to set field. Err: %v", err)
+	}
+
+	if plainCollider.Radius != 2 || !plainCollider.IsTrigger {
+		t.Fatalf("Expected plain instance to get radius 2 and trigger, but got %v and %v", plainCollider.Radius, plainCollider.IsTrigger)
+	}
+
+	if overridingCollider.Radius != 7 || !overridingCollider.IsTrigger {
+		t.Fatalf("Expected overriding instance to keep radius 7 but get trigger, but got %v and %v", overridingCollider.Radius, overridingCollider.IsTrigger)
+	}
+
+	// Clearing the override restores the prefab value and lets later changes through
+	if err = overriding.ClearOverride(key, "Radius"); err != nil {
+		t.Fatalf("Failed to clear override. Err: %v", err)
+	}
+
+	if overridingCollider.Radius != 2 {
+		t.Fatalf("Expected ClearOverride to restore radius 2, but got %v", overridingCollider.Radius)
+	}
+
+	if err = p.SetField(key, "Radius", 3); err != nil {
+		t.Fatalf("Failed to set field. Err: %v", err)
+	}
+
+	if overridingCollider.Radius != 3 || plainCollider.Radius != 3 {
+		t.Fatalf("Expected both instances to get radius 3, but got %v and %v", plainCollider.Radius, overridingCollider.Radius)
+	}
+
+	// An instance edited directly (e.g. in an editor) only gets overrides for the changed fields
+	plainCollider.IsTrigger = false
+	if err = plain.DetectOverrides(); err != nil {
+		t.Fatalf("Failed to detect overrides. Err: %v", err)
+	}
+
+	if !plain.IsOverridden(key, "IsTrigger") || plain.IsOverridden(key, "Radius") {
+		t.Fatalf("Expected only IsTrigger to be detected as overridden, but got overrides %v", plain.Overrides)
+	}
+
+	if err = p.SetField(key, "IsTrigger", true); err != nil {
+		t.Fatalf("Failed to set field. Err: %v", err)
+	}
+
+	if err = p.SetField(key, "Radius", 4); err != nil {
+		t.Fatalf("Failed to set field. Err: %v", err)
+	}
+
+	if plainCollider.IsTrigger || plainCollider.Radius != 4 {
+		t.Fatalf("Expected detected override to keep trigger off while radius changes to 4, but got %v and %v", plainCollider.IsTrigger, plainCollider.Radius)
+	}
+}
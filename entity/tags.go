@@ -0,0 +1,285 @@
+package entity
+
+import (
+	"sync"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/layers"
+	"github.com/bloeys/nmage/registry"
+)
+
+// TagId is an interned tag name. Ids are only stable during a single run, so tag names should be used when serializing
+type TagId uint32
+
+var (
+	// Tags can be interned while loading levels in the background, so access is locked
+	tagsLock sync.RWMutex
+	tagIds   = make(map[string]TagId)
+	tagNames = []string{""}
+)
+
+// InternTag returns the id of the tag, creating one if this is the first time the tag is seen.
+// Id zero is never used by a tag
+func InternTag(name string) TagId {
+
+	assert.T(name != "", "Tag name can not be empty")
+
+	tagsLock.RLock()
+	id, ok := tagIds[name]
+	tagsLock.RUnlock()
+	if ok {
+		return id
+	}
+
+	tagsLock.Lock()
+	defer tagsLock.Unlock()
+
+	// Another goroutine might have added it between the two locks
+	if id, ok := tagIds[name]; ok {
+		return id
+	}
+
+	id = TagId(len(tagNames))
+	tagIds[name] = id
+	tagNames = append(tagNames, name)
+	return id
+}
+
+func (t TagId) String() string {
+
+	tagsLock.RLock()
+	defer tagsLock.RUnlock()
+
+	if int(t) >= len(tagNames) {
+		return ""
+	}
+
+	return tagNames[t]
+}
+
+// EntityMeta is the tags and layers of an entity
+type EntityMeta struct {
+	Tags   []TagId
+	Layers layers.Mask
+}
+
+func (em *EntityMeta) HasTag(tag TagId) bool {
+
+	for i := 0; i < len(em.Tags); i++ {
+		if em.Tags[i] == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleList is a set of handles that keeps insertion order, so that queries visit entities in a deterministic order.
+// Removed handles leave a zero handle behind, and the list is compacted once half of it is holes
+type handleList struct {
+	handles   []registry.Handle
+	positions map[registry.Handle]int
+	holeCount int
+}
+
+func (hl *handleList) add(h registry.Handle) {
+
+	if _, ok := hl.positions[h]; ok {
+		return
+	}
+
+	hl.positions[h] = len(hl.handles)
+	hl.handles = append(hl.handles, h)
+}
+
+func (hl *handleList) remove(h registry.Handle) {
+
+	pos, ok := hl.positions[h]
+	if !ok {
+		return
+	}
+
+	// Zero is never an alive handle, since alive handles have an odd generation
+	hl.handles[pos] = 0
+	delete(hl.positions, h)
+	hl.holeCount++
+
+	if hl.holeCount*2 < len(hl.handles) {
+		return
+	}
+
+	compacted := hl.handles[:0]
+	for _, h := range hl.handles {
+
+		if h == 0 {
+			continue
+		}
+
+		hl.positions[h] = len(compacted)
+		compacted = append(compacted, h)
+	}
+
+	// Clear the tail so the backing array doesn't keep stale handles
+	for i := len(compacted); i < len(hl.handles); i++ {
+		hl.handles[i] = 0
+	}
+
+	hl.handles = compacted
+	hl.holeCount = 0
+}
+
+func newHandleList() *handleList {
+	return &handleList{
+		handles:   make([]registry.Handle, 0),
+		positions: make(map[registry.Handle]int),
+	}
+}
+
+// EntityMetaStore keeps the tags and layers of entities, with an index of entities by tag so that queries don't go over all entities.
+// Queries visit entities in the order they were first given meta (or the tag, for tag queries).
+//
+// Entities without stored meta are considered to have no tags and to be on the default layer by Get/GetLayers/HasTag.
+// The store doesn't know about such entities though, so they are never visited by queries
+type EntityMetaStore struct {
+	metas    map[registry.Handle]*EntityMeta
+	handles  *handleList
+	tagIndex map[TagId]*handleList
+}
+
+func (s *EntityMetaStore) getOrCreate(h registry.Handle) *EntityMeta {
+
+	em := s.metas[h]
+	if em == nil {
+		em = &EntityMeta{
+			Tags:   make([]TagId, 0, 1),
+			Layers: layers.Mask_Default,
+		}
+		s.metas[h] = em
+		s.handles.add(h)
+	}
+
+	return em
+}
+
+// Get returns the meta of the entity, or nil if the entity has no tags and was never assigned layers
+func (s *EntityMetaStore) Get(h registry.Handle) *EntityMeta {
+	return s.metas[h]
+}
+
+func (s *EntityMetaStore) AddTag(h registry.Handle, tag TagId) {
+
+	em := s.getOrCreate(h)
+	if em.HasTag(tag) {
+		return
+	}
+
+	em.Tags = append(em.Tags, tag)
+
+	entities := s.tagIndex[tag]
+	if entities == nil {
+		entities = newHandleList()
+		s.tagIndex[tag] = entities
+	}
+	entities.add(h)
+}
+
+func (s *EntityMetaStore) RemoveTag(h registry.Handle, tag TagId) {
+
+	em := s.metas[h]
+	if em == nil {
+		return
+	}
+
+	for i := 0; i < len(em.Tags); i++ {
+
+		if em.Tags[i] != tag {
+			continue
+		}
+
+		em.Tags = append(em.Tags[:i], em.Tags[i+1:]...)
+		s.tagIndex[tag].remove(h)
+		return
+	}
+}
+
+func (s *EntityMetaStore) HasTag(h registry.Handle, tag TagId) bool {
+
+	em := s.metas[h]
+	if em == nil {
+		return false
+	}
+
+	return em.HasTag(tag)
+}
+
+func (s *EntityMetaStore) SetLayers(h registry.Handle, mask layers.Mask) {
+	s.getOrCreate(h).Layers = mask
+}
+
+func (s *EntityMetaStore) GetLayers(h registry.Handle) layers.Mask {
+
+	em := s.metas[h]
+	if em == nil {
+		return layers.Mask_Default
+	}
+
+	return em.Layers
+}
+
+// Remove deletes all meta of the entity. Should be called when the entity is freed
+func (s *EntityMetaStore) Remove(h registry.Handle) {
+
+	em := s.metas[h]
+	if em == nil {
+		return
+	}
+
+	for _, tag := range em.Tags {
+		s.tagIndex[tag].remove(h)
+	}
+
+	delete(s.metas, h)
+	s.handles.remove(h)
+}
+
+// Query calls fn for every entity that has the tag and is on at least one of the layers in the mask, in the order the entities got the tag.
+// Use layers.Mask_All to ignore layers. Entities must not be tagged/untagged or removed from within fn
+func (s *EntityMetaStore) Query(tag TagId, mask layers.Mask, fn func(h registry.Handle)) {
+
+	entities := s.tagIndex[tag]
+	if entities == nil {
+		return
+	}
+
+	for _, h := range entities.handles {
+
+		if h == 0 || !s.metas[h].Layers.Intersects(mask) {
+			continue
+		}
+
+		fn(h)
+	}
+}
+
+// QueryLayers calls fn for every entity with stored meta that is on at least one of the layers in the mask, in the order the entities got their meta.
+// Entities without stored meta are not visited even if the mask has the default layer, so entities that should be found
+// by this must have their layers set using SetLayers. Entities must not be tagged/untagged or removed from within fn
+func (s *EntityMetaStore) QueryLayers(mask layers.Mask, fn func(h registry.Handle)) {
+
+	for _, h := range s.handles.handles {
+
+		if h == 0 || !s.metas[h].Layers.Intersects(mask) {
+			continue
+		}
+
+		fn(h)
+	}
+}
+
+func NewEntityMetaStore() *EntityMetaStore {
+	return &EntityMetaStore{
+		metas:    make(map[registry.Handle]*EntityMeta),
+		handles:  newHandleList(),
+		tagIndex: make(map[TagId]*handleList),
+	}
+}
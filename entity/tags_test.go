@@ -0,0 +1,129 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/bloeys/nmage/layers"
+	"github.com/bloeys/nmage/registry"
+)
+
+func collectQuery(s *EntityMetaStore, tag TagId, mask layers.Mask) []registry.Handle {
+
+	out := make([]registry.Handle, 0)
+	s.Query(tag, mask, func(h registry.Handle) {
+		out = append(out, h)
+	})
+
+	return out
+}
+
+func collectQueryLayers(s *EntityMetaStore, mask layers.Mask) []registry.Handle {
+
+	out := make([]registry.Handle, 0)
+	s.QueryLayers(mask, func(h registry.Handle) {
+		out = append(out, h)
+	})
+
+	return out
+}
+
+func handlesEqual(a, b []registry.Handle) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := 0; i < len(a); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestEntityMetaStoreQueryOrder(t *testing.T) {
+
+	const count = 100
+
+	s := NewEntityMetaStore()
+	tag := InternTag("test-order")
+
+	// Add in reverse index order so that handle order and insertion order differ
+	expected := make([]registry.Handle, 0, count)
+	for i := count - 1; i >= 0; i-- {
+		h := registry.NewHandle(1, uint64(i))
+		s.AddTag(h, tag)
+		expected = append(expected, h)
+	}
+
+	for i := 0; i < 5; i++ {
+
+		if got := collectQuery(s, tag, layers.Mask_All); !handlesEqual(got, expected) {
+			t.Fatalf("Expected Query to visit entities in insertion order. Expected %v, but got %v", expected, got)
+		}
+
+		if got := collectQueryLayers(s, layers.Mask_All); !handlesEqual(got, expected) {
+			t.Fatalf("Expected QueryLayers to visit entities in insertion order. Expected %v, but got %v", expected, got)
+		}
+	}
+
+	// Remove most entities so the lists get compacted, and check order is kept
+	kept := make([]registry.Handle, 0)
+	for i, h := range expected {
+
+		if i%4 == 0 {
+			kept = append(kept, h)
+			continue
+		}
+
+		if i%2 == 0 {
+			s.RemoveTag(h, tag)
+		} else {
+			s.Remove(h)
+		}
+	}
+
+	if got := collectQuery(s, tag, layers.Mask_All); !handlesEqual(got, kept) {
+		t.Fatalf("Expected Query to keep insertion order after removals. Expected %v, but got %v", kept, got)
+	}
+
+	// Re-adding puts the entity at the end
+	readded := expected[1]
+	s.AddTag(readded, tag)
+	kept = append(kept, readded)
+	if got := collectQuery(s, tag, layers.Mask_All); !handlesEqual(got, kept) {
+		t.Fatalf("Expected re-added entity at the end. Expected %v, but got %v", kept, got)
+	}
+}
+
+func TestEntityMetaStoreLayers(t *testing.T) {
+
+	s := NewEntityMetaStore()
+	tag := InternTag("test-layers")
+
+	noMeta := registry.NewHandle(1, 0)
+	defaultLayer := registry.NewHandle(1, 1)
+	otherLayer := registry.NewHandle(1, 2)
+
+	s.AddTag(defaultLayer, tag)
+	s.AddTag(otherLayer, tag)
+	s.SetLayers(otherLayer, layers.Layer(3))
+
+	if s.GetLayers(noMeta) != layers.Mask_Default || s.Get(noMeta) != nil || s.HasTag(noMeta, tag) {
+		t.Fatalf("Expected an entity without meta to have no tags and be on the default layer")
+	}
+
+	if got := collectQuery(s, tag, layers.Mask_Default); !handlesEqual(got, []registry.Handle{defaultLayer}) {
+		t.Fatalf("Expected only the default layer entity, but got %v", got)
+	}
+
+	// Entities without stored meta are unknown to the store, so they are not visited
+	if got := collectQueryLayers(s, layers.Mask_Default); !handlesEqual(got, []registry.Handle{defaultLayer}) {
+		t.Fatalf("Expected only the default layer entity with meta, but got %v", got)
+	}
+
+	if got := collectQueryLayers(s, layers.Layer(3)); !handlesEqual(got, []registry.Handle{otherLayer}) {
+		t.Fatalf("Expected only the entity on layer 3, but got %v", got)
+	}
+}
@@ -0,0 +1,275 @@
+package entity
+
+import (
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/registry"
+)
+
+var _ Comp = &TransformComp{}
+
+func init() {
+	RegisterCompType[TransformComp]("Transform")
+}
+
+// TransformComp is a position, rotation and scale relative to an optional parent transform.
+//
+// The world matrix is cached and only recalculated when the transform or one of its parents changes.
+// If Pos/Rot/Scale are changed directly then MarkDirty must be called, otherwise use the setters which do that automatically.
+//
+// World position/rotation/scale assume no shearing, which means they are not exact if a parent has a non-uniform scale and a child is rotated.
+// The world matrix is always exact
+type TransformComp struct {
+	BaseComp
+
+	Pos   gglm.Vec3
+	Rot   gglm.Quat
+	Scale gglm.Vec3
+
+	parent   *TransformComp
+	children []*TransformComp
+
+	// Stored as 'valid' so that new transforms start dirty
+	isWorldMatValid bool
+	worldMat        gglm.TrMat
+}
+
+func (t *TransformComp) Name() string {
+	return "Transform Component"
+}
+
+// IsUnique returns true because an entity can only have one transform
+func (t *TransformComp) IsUnique() bool {
+	return true
+}
+
+// Destroy detaches the transform from its parent, and makes its children root transforms that keep their world transform
+func (t *TransformComp) Destroy() {
+
+	for len(t.children) > 0 {
+		t.children[len(t.children)-1].SetParent(nil, true)
+	}
+
+	t.SetParent(nil, false)
+}
+
+func (t *TransformComp) SetPos(pos *gglm.Vec3) {
+	t.Pos = *pos
+	t.MarkDirty()
+}
+
+func (t *TransformComp) SetRot(rot *gglm.Quat) {
+	t.Rot = *rot
+	t.MarkDirty()
+}
+
+func (t *TransformComp) SetScale(scale *gglm.Vec3) {
+	t.Scale = *scale
+	t.MarkDirty()
+}
+
+// MarkDirty makes the world matrix of this transform and all its children get recalculated when next needed
+func (t *TransformComp) MarkDirty() {
+
+	// A dirty transform always has dirty children, so no need to go further
+	if !t.isWorldMatValid {
+		return
+	}
+
+	t.isWorldMatValid = false
+	for _, c := range t.children {
+		c.MarkDirty()
+	}
+}
+
+// LocalMat returns the matrix of this transform relative to its parent
+func (t *TransformComp) LocalMat() *gglm.TrMat {
+	return gglm.NewTranslationMat(&t.Pos).Mul(gglm.NewRotMat(&t.Rot).Mul(gglm.NewScaleMat(&t.Scale)))
+}
+
+// WorldMat returns the cached world matrix, recalculating it if dirty. This can be passed directly to renderer.Render.Draw.
+// The returned matrix should NOT be modified, and must be cloned first if it needs to be changed
+func (t *TransformComp) WorldMat() *gglm.TrMat {
+
+	if t.isWorldMatValid {
+		return &t.worldMat
+	}
+
+	if t.parent == nil {
+		t.worldMat = *t.LocalMat()
+	} else {
+		t.worldMat = *t.parent.WorldMat().Clone().Mul(t.LocalMat())
+	}
+
+	t.isWorldMatValid = true
+	return &t.worldMat
+}
+
+func (t *TransformComp) WorldPos() *gglm.Vec3 {
+	m := t.WorldMat()
+	return &gglm.Vec3{Data: [3]float32{m.Data[3][0], m.Data[3][1], m.Data[3][2]}}
+}
+
+func (t *TransformComp) WorldRot() *gglm.Quat {
+
+	if t.parent == nil {
+		rot := t.Rot
+		return &rot
+	}
+
+	return quatMul(t.parent.WorldRot(), &t.Rot)
+}
+
+func (t *TransformComp) WorldScale() *gglm.Vec3 {
+
+	if t.parent == nil {
+		return t.Scale.Clone()
+	}
+
+	parentScale := t.parent.WorldScale()
+	return &gglm.Vec3{Data: [3]float32{
+		parentScale.Data[0] * t.Scale.Data[0],
+		parentScale.Data[1] * t.Scale.Data[1],
+		parentScale.Data[2] * t.Scale.Data[2],
+	}}
+}
+
+func (t *TransformComp) Parent() *TransformComp {
+	return t.parent
+}
+
+// ParentHandle returns the entity handle of the parent, or a zero handle if there is no parent
+func (t *TransformComp) ParentHandle() registry.Handle {
+
+	if t.parent == nil {
+		return 0
+	}
+
+	return t.parent.Handle
+}
+
+func (t *TransformComp) Children() []*TransformComp {
+	return t.children
+}
+
+// ChildHandles returns the entity handles of all direct children
+func (t *TransformComp) ChildHandles() []registry.Handle {
+
+	handles := make([]registry.Handle, len(t.children))
+	for i := 0; i < len(t.children); i++ {
+		handles[i] = t.children[i].Handle
+	}
+
+	return handles
+}
+
+// SetParent changes the parent of the transform. A nil parent makes this a root transform.
+//
+// If keepWorld is true then the local position/rotation/scale are changed so that the world transform stays the same,
+// otherwise the local values are kept and the transform moves with its new parent
+func (t *TransformComp) SetParent(newParent *TransformComp, keepWorld bool) {
+
+	if newParent == t.parent {
+		return
+	}
+
+	for p := newParent; p != nil; p = p.parent {
+		assert.T(p != t, "Can not parent a transform to itself or to one of its children")
+	}
+
+	var worldPos, worldScale *gglm.Vec3
+	var worldRot *gglm.Quat
+	if keepWorld {
+		worldPos = t.WorldPos()
+		worldRot = t.WorldRot()
+		worldScale = t.WorldScale()
+	}
+
+	if t.parent != nil {
+
+		siblings := t.parent.children
+		for i := 0; i < len(siblings); i++ {
+			if siblings[i] == t {
+				t.parent.children = append(siblings[:i], siblings[i+1:]...)
+				break
+			}
+		}
+	}
+
+	t.parent = newParent
+	if newParent != nil {
+		newParent.children = append(newParent.children, t)
+	}
+
+	if keepWorld {
+
+		if newParent == nil {
+			t.Pos = *worldPos
+			t.Rot = *worldRot
+			t.Scale = *worldScale
+		} else {
+
+			// local = inverse(parentWorld) * world, done per component
+			parentPos := newParent.WorldPos()
+			parentRot := newParent.WorldRot()
+			parentScale := newParent.WorldScale()
+			invParentRot := quatConj(parentRot)
+
+			relPos := quatRotateVec(invParentRot, &gglm.Vec3{Data: [3]float32{
+				worldPos.Data[0] - parentPos.Data[0],
+				worldPos.Data[1] - parentPos.Data[1],
+				worldPos.Data[2] - parentPos.Data[2],
+			}})
+
+			t.Pos = gglm.Vec3{Data: [3]float32{
+				relPos.Data[0] / parentScale.Data[0],
+				relPos.Data[1] / parentScale.Data[1],
+				relPos.Data[2] / parentScale.Data[2],
+			}}
+			t.Rot = *quatMul(invParentRot, worldRot)
+			t.Scale = gglm.Vec3{Data: [3]float32{
+				worldScale.Data[0] / parentScale.Data[0],
+				worldScale.Data[1] / parentScale.Data[1],
+				worldScale.Data[2] / parentScale.Data[2],
+			}}
+		}
+	}
+
+	// Force dirty even if we are already marked, since our parent changed
+	t.isWorldMatValid = true
+	t.MarkDirty()
+}
+
+func NewTransformComp(pos *gglm.Vec3, rot *gglm.Quat, scale *gglm.Vec3) *TransformComp {
+	return &TransformComp{
+		Pos:   *pos,
+		Rot:   *rot,
+		Scale: *scale,
+	}
+}
+
+// quatMul returns q1*q2, which is a rotation by q2 followed by q1
+func quatMul(q1, q2 *gglm.Quat) *gglm.Quat {
+
+	x1, y1, z1, w1 := q1.Data[0], q1.Data[1], q1.Data[2], q1.Data[3]
+	x2, y2, z2, w2 := q2.Data[0], q2.Data[1], q2.Data[2], q2.Data[3]
+
+	return &gglm.Quat{Vec4: gglm.Vec4{Data: [4]float32{
+		w1*x2 + x1*w2 + y1*z2 - z1*y2,
+		w1*y2 - x1*z2 + y1*w2 + z1*x2,
+		w1*z2 + x1*y2 - y1*x2 + z1*w2,
+		w1*w2 - x1*x2 - y1*y2 - z1*z2,
+	}}}
+}
+
+// quatConj returns the conjugate of q, which is its inverse when q is normalized
+func quatConj(q *gglm.Quat) *gglm.Quat {
+	return &gglm.Quat{Vec4: gglm.Vec4{Data: [4]float32{-q.Data[0], -q.Data[1], -q.Data[2], q.Data[3]}}}
+}
+
+func quatRotateVec(q *gglm.Quat, v *gglm.Vec3) *gglm.Vec3 {
+
+	vq := &gglm.Quat{Vec4: gglm.Vec4{Data: [4]float32{v.Data[0], v.Data[1], v.Data[2], 0}}}
+	res := quatMul(quatMul(q, vq), quatConj(q))
+	return &gglm.Vec3{Data: [3]float32{res.Data[0], res.Data[1], res.Data[2]}}
+}
@@ -0,0 +1,218 @@
+package entity
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bloeys/gglm/gglm"
+)
+
+const transformEpsilon = 1e-4
+
+func approxEq(a, b float32) bool {
+	return math.Abs(float64(a-b)) < transformEpsilon
+}
+
+func approxVec3(a, b *gglm.Vec3) bool {
+	return approxEq(a.Data[0], b.Data[0]) && approxEq(a.Data[1], b.Data[1]) && approxEq(a.Data[2], b.Data[2])
+}
+
+// approxQuat treats q and -q as equal since they are the same rotation
+func approxQuat(a, b *gglm.Quat) bool {
+
+	sameSign := true
+	flippedSign := true
+	for i := 0; i < 4; i++ {
+		sameSign = sameSign && approxEq(a.Data[i], b.Data[i])
+		flippedSign = flippedSign && approxEq(a.Data[i], -b.Data[i])
+	}
+
+	return sameSign || flippedSign
+}
+
+func approxMat(a, b *gglm.TrMat) bool {
+
+	for c := 0; c < 4; c++ {
+		for r := 0; r < 4; r++ {
+			if !approxEq(a.Data[c][r], b.Data[c][r]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func rotZ(deg float32) *gglm.Quat {
+	return gglm.NewQuatAngleAxis(deg*math.Pi/180, gglm.NewVec3(0, 0, 1))
+}
+
+// trsMat builds the matrix of a transform without a parent
+func trsMat(pos *gglm.Vec3, rot *gglm.Quat, scale *gglm.Vec3) *gglm.TrMat {
+	return gglm.NewTranslationMat(pos).Mul(gglm.NewRotMat(rot).Mul(gglm.NewScaleMat(scale)))
+}
+
+func checkWorld(t *testing.T, name string, tr *TransformComp, pos *gglm.Vec3, rot *gglm.Quat, scale *gglm.Vec3) {
+
+	t.Helper()
+
+	if got := tr.WorldPos(); !approxVec3(got, pos) {
+		t.Fatalf("%s: expected world pos %s, but got %s", name, pos.String(), got.String())
+	}
+
+	if got := tr.WorldRot(); !approxQuat(got, rot) {
+		t.Fatalf("%s: expected world rot %v, but got %v", name, rot.Data, got.Data)
+	}
+
+	if got := tr.WorldScale(); !approxVec3(got, scale) {
+		t.Fatalf("%s: expected world scale %s, but got %s", name, scale.String(), got.String())
+	}
+
+	if expected := trsMat(pos, rot, scale); !approxMat(tr.WorldMat(), expected) {
+		t.Fatalf("%s: expected world mat %v, but got %v", name, expected.Data, tr.WorldMat().Data)
+	}
+}
+
+func TestTransformWorldValuesWithRotatedScaledParent(t *testing.T) {
+
+	parent := NewTransformComp(gglm.NewVec3(10, 0, 0), rotZ(90), gglm.NewVec3(2, 2, 2))
+	child := NewTransformComp(gglm.NewVec3(1, 0, 0), rotZ(90), gglm.NewVec3(1, 3, 1))
+	grandChild := NewTransformComp(gglm.NewVec3(0, 1, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+
+	child.SetParent(parent, false)
+	grandChild.SetParent(child, false)
+
+	checkWorld(t, "parent", parent, gglm.NewVec3(10, 0, 0), rotZ(90), gglm.NewVec3(2, 2, 2))
+
+	// The parent scales the child offset by 2 and rotates it from +X to +Y
+	checkWorld(t, "child", child, gglm.NewVec3(10, 2, 0), rotZ(180), gglm.NewVec3(2, 6, 2))
+
+	// The grand child offset is scaled by 2*3 and rotated from +Y to -Y
+	checkWorld(t, "grand child", grandChild, gglm.NewVec3(10, -4, 0), rotZ(180), gglm.NewVec3(2, 6, 2))
+
+	expectedMat := parent.WorldMat().Clone().Mul(child.LocalMat())
+	if !approxMat(child.WorldMat(), expectedMat) {
+		t.Fatalf("Expected child world mat to be parent world mat times child local mat. Expected %v, but got %v", expectedMat.Data, child.WorldMat().Data)
+	}
+}
+
+func TestTransformSetParentKeepWorld(t *testing.T) {
+
+	origPos := gglm.NewVec3(3, 4, 5)
+	origRot := gglm.NewQuatEulerXYZ(0.3, -0.7, 1.1)
+	origScale := gglm.NewVec3(1, 2, 3)
+
+	parent := NewTransformComp(gglm.NewVec3(1, 1, 1), rotZ(90), gglm.NewVec3(2, 2, 2))
+	child := NewTransformComp(origPos, origRot, origScale)
+
+	child.SetParent(parent, true)
+	if child.Parent() != parent || len(parent.Children()) != 1 || parent.Children()[0] != child {
+		t.Fatalf("Expected child to be parented")
+	}
+	checkWorld(t, "after parenting", child, origPos, origRot, origScale)
+
+	// Moving to another parent must also keep the world values
+	otherParent := NewTransformComp(gglm.NewVec3(-5, 2, 0), rotZ(-45), gglm.NewVec3(0.5, 0.5, 0.5))
+	child.SetParent(otherParent, true)
+	if len(parent.Children()) != 0 {
+		t.Fatalf("Expected old parent to have no children, but got %d", len(parent.Children()))
+	}
+	checkWorld(t, "after reparenting", child, origPos, origRot, origScale)
+
+	child.SetParent(nil, true)
+	checkWorld(t, "after unparenting", child, origPos, origRot, origScale)
+
+	if !approxVec3(&child.Pos, origPos) || !approxQuat(&child.Rot, origRot) || !approxVec3(&child.Scale, origScale) {
+		t.Fatalf("Expected local values of a root transform to equal its world values. Got pos=%s, rot=%v, scale=%s", child.Pos.String(), child.Rot.Data, child.Scale.String())
+	}
+}
+
+func TestTransformDestroyMakesChildrenRoots(t *testing.T) {
+
+	grandParent := NewTransformComp(gglm.NewVec3(0, 5, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+	parent := NewTransformComp(gglm.NewVec3(10, 0, 0), rotZ(90), gglm.NewVec3(2, 2, 2))
+	child1 := NewTransformComp(gglm.NewVec3(1, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+	child2 := NewTransformComp(gglm.NewVec3(0, 0, 1), rotZ(90), gglm.NewVec3(1, 1, 1))
+
+	parent.SetParent(grandParent, false)
+	child1.SetParent(parent, false)
+	child2.SetParent(parent, false)
+
+	children := []*TransformComp{child1, child2}
+	worldPos := make([]*gglm.Vec3, len(children))
+	worldRot := make([]*gglm.Quat, len(children))
+	worldScale := make([]*gglm.Vec3, len(children))
+	for i, c := range children {
+		worldPos[i] = c.WorldPos()
+		worldRot[i] = c.WorldRot()
+		worldScale[i] = c.WorldScale()
+	}
+
+	parent.Destroy()
+
+	if parent.Parent() != nil || len(grandParent.Children()) != 0 {
+		t.Fatalf("Expected destroyed transform to be detached from its parent")
+	}
+
+	if len(parent.Children()) != 0 {
+		t.Fatalf("Expected destroyed transform to have no children, but got %d", len(parent.Children()))
+	}
+
+	for i, c := range children {
+
+		if c.Parent() != nil {
+			t.Fatalf("Expected child %d to be a root transform", i)
+		}
+
+		checkWorld(t, "child after destroy", c, worldPos[i], worldRot[i], worldScale[i])
+	}
+}
+
+func TestTransformDirtyReachesChildren(t *testing.T) {
+
+	root := NewTransformComp(gglm.NewVec3(0, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+	mid := NewTransformComp(gglm.NewVec3(1, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+	leaf := NewTransformComp(gglm.NewVec3(1, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+
+	mid.SetParent(root, false)
+	leaf.SetParent(mid, false)
+
+	// Calculating the leaf calculates and caches the whole chain
+	if got := leaf.WorldPos(); !approxVec3(got, gglm.NewVec3(2, 0, 0)) {
+		t.Fatalf("Expected leaf world pos (2, 0, 0), but got %s", got.String())
+	}
+
+	if !root.isWorldMatValid || !mid.isWorldMatValid || !leaf.isWorldMatValid {
+		t.Fatalf("Expected all world matrices to be cached")
+	}
+
+	root.SetPos(gglm.NewVec3(0, 10, 0))
+	if root.isWorldMatValid || mid.isWorldMatValid || leaf.isWorldMatValid {
+		t.Fatalf("Expected changing the root to mark all descendants dirty")
+	}
+
+	if got := leaf.WorldPos(); !approxVec3(got, gglm.NewVec3(2, 10, 0)) {
+		t.Fatalf("Expected leaf world pos (2, 10, 0), but got %s", got.String())
+	}
+
+	// Changing a middle transform must not dirty its parent
+	mid.SetScale(gglm.NewVec3(3, 3, 3))
+	if !root.isWorldMatValid || mid.isWorldMatValid || leaf.isWorldMatValid {
+		t.Fatalf("Expected only the changed transform and its children to be dirty")
+	}
+
+	// Direct field changes followed by MarkDirty
+	root.Pos = gglm.Vec3{Data: [3]float32{0, 0, 7}}
+	root.MarkDirty()
+	if got := leaf.WorldPos(); !approxVec3(got, gglm.NewVec3(4, 0, 7)) {
+		t.Fatalf("Expected leaf world pos (4, 0, 7), but got %s", got.String())
+	}
+
+	// Reparenting the middle transform must dirty its children even if the middle one is already dirty
+	otherRoot := NewTransformComp(gglm.NewVec3(-100, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+	mid.MarkDirty()
+	mid.SetParent(otherRoot, false)
+	if got := leaf.WorldPos(); !approxVec3(got, gglm.NewVec3(-96, 0, 0)) {
+		t.Fatalf("Expected leaf world pos (-96, 0, 0) after reparenting, but got %s", got.String())
+	}
+}
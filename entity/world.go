@@ -0,0 +1,362 @@
+package entity
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/registry"
+)
+
+const (
+	MaxWorldCompTypes = 256
+)
+
+type compTypeId uint16
+
+// compMask is a bitset of component type ids
+type compMask [MaxWorldCompTypes / 64]uint64
+
+func (m *compMask) Set(id compTypeId) {
+	m[id/64] |= 1 << (id % 64)
+}
+
+func (m *compMask) Unset(id compTypeId) {
+	m[id/64] &^= 1 << (id % 64)
+}
+
+func (m *compMask) Has(id compTypeId) bool {
+	return m[id/64]&(1<<(id%64)) != 0
+}
+
+func (m *compMask) HasAll(other *compMask) bool {
+
+	for i := 0; i < len(m); i++ {
+		if m[i]&other[i] != other[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// column is a type erased array of components of a single type.
+// Typed access is done by asserting to *typedColumn[T] once per archetype, not per entity
+type column interface {
+	appendFrom(src column, row int)
+	swapRemove(row int)
+	newEmpty() column
+}
+
+type typedColumn[T any] struct {
+	data []T
+}
+
+func (c *typedColumn[T]) appendFrom(src column, row int) {
+	c.data = append(c.data, src.(*typedColumn[T]).data[row])
+}
+
+func (c *typedColumn[T]) swapRemove(row int) {
+
+	last := len(c.data) - 1
+	c.data[row] = c.data[last]
+
+	// Zero the removed component so we don't keep anything it points to alive
+	var zero T
+	c.data[last] = zero
+	c.data = c.data[:last]
+}
+
+func (c *typedColumn[T]) newEmpty() column {
+	return &typedColumn[T]{data: make([]T, 0, 16)}
+}
+
+// archetype stores all entities that have the exact same set of components.
+// Row 'i' of every column belongs to entities[i]
+type archetype struct {
+	mask        compMask
+	compTypeIds []compTypeId
+	columns     []column
+
+	// colIndices maps a component type id to its index in columns
+	colIndices map[compTypeId]int
+	entities   []registry.Handle
+
+	// Cached archetypes reached by adding/removing a single component type
+	addEdges    map[compTypeId]*archetype
+	removeEdges map[compTypeId]*archetype
+}
+
+type entityRecord struct {
+	arch *archetype
+	row  int
+}
+
+// World owns entities and stores their components by archetype, where each archetype
+// keeps every component type in its own typed array.
+//
+// Pointers to components returned by the world are ONLY valid until the next structural change
+// (i.e. creating/destroying entities or adding/removing components), as components might be moved.
+// Structural changes are not allowed while a query is running.
+//
+// It is NOT safe to use a world concurrently
+type World struct {
+	entities *registry.Registry[entityRecord]
+
+	compTypes      map[reflect.Type]compTypeId
+	compTypeCols   []column
+	archetypes     []*archetype
+	archetypesByID map[string]*archetype
+	rootArchetype  *archetype
+
+	runningQueries int
+}
+
+func NewWorld(size uint32) *World {
+
+	w := &World{
+		entities:       registry.NewRegistry[entityRecord](size),
+		compTypes:      make(map[reflect.Type]compTypeId),
+		compTypeCols:   make([]column, 0),
+		archetypes:     make([]*archetype, 0),
+		archetypesByID: make(map[string]*archetype),
+	}
+
+	w.rootArchetype = w.getOrCreateArchetype(nil)
+	return w
+}
+
+// NewEntity creates an entity with no components
+func (w *World) NewEntity() (registry.Handle, error) {
+
+	w.assertNotQuerying()
+
+	rec, handle, err := w.entities.New()
+	if err != nil {
+		return 0, err
+	}
+
+	rec.arch = w.rootArchetype
+	rec.row = len(w.rootArchetype.entities)
+	w.rootArchetype.entities = append(w.rootArchetype.entities, handle)
+
+	return handle, nil
+}
+
+// DestroyEntity removes the entity and all its components. Does nothing if the entity is not alive
+func (w *World) DestroyEntity(h registry.Handle) {
+
+	w.assertNotQuerying()
+
+	rec := w.entities.Get(h)
+	if rec == nil {
+		return
+	}
+
+	w.removeRow(rec.arch, rec.row)
+	w.entities.Free(h)
+}
+
+func (w *World) IsAlive(h registry.Handle) bool {
+	return w.entities.Get(h) != nil
+}
+
+func (w *World) EntityCount() uint {
+	return w.entities.ItemCount
+}
+
+// removeRow swap-removes the row from the archetype and fixes the row of the entity that got moved
+func (w *World) removeRow(arch *archetype, row int) {
+
+	for i := 0; i < len(arch.columns); i++ {
+		arch.columns[i].swapRemove(row)
+	}
+
+	last := len(arch.entities) - 1
+	if row != last {
+		movedHandle := arch.entities[last]
+		arch.entities[row] = movedHandle
+		w.entities.Get(movedHandle).row = row
+	}
+
+	arch.entities = arch.entities[:last]
+}
+
+// moveEntity moves the entity to the destination archetype, copying all components shared by
+// both archetypes. Components only in the destination are left for the caller to append
+func (w *World) moveEntity(h registry.Handle, rec *entityRecord, dst *archetype) {
+
+	src := rec.arch
+	for i := 0; i < len(src.columns); i++ {
+
+		dstColIndex, ok := dst.colIndices[src.compTypeIds[i]]
+		if !ok {
+			continue
+		}
+
+		dst.columns[dstColIndex].appendFrom(src.columns[i], rec.row)
+	}
+
+	w.removeRow(src, rec.row)
+
+	rec.arch = dst
+	rec.row = len(dst.entities)
+	dst.entities = append(dst.entities, h)
+}
+
+func (w *World) assertNotQuerying() {
+	assert.T(w.runningQueries == 0, "Can not create/destroy entities or add/remove components while a query is running")
+}
+
+func (w *World) getOrCreateArchetype(compTypeIds []compTypeId) *archetype {
+
+	sort.Slice(compTypeIds, func(i, j int) bool { return compTypeIds[i] < compTypeIds[j] })
+
+	sb := strings.Builder{}
+	for i := 0; i < len(compTypeIds); i++ {
+		sb.WriteString(strconv.Itoa(int(compTypeIds[i])))
+		sb.WriteByte(',')
+	}
+
+	id := sb.String()
+	if arch, ok := w.archetypesByID[id]; ok {
+		return arch
+	}
+
+	arch := &archetype{
+		compTypeIds: compTypeIds,
+		columns:     make([]column, len(compTypeIds)),
+		colIndices:  make(map[compTypeId]int, len(compTypeIds)),
+		entities:    make([]registry.Handle, 0, 16),
+		addEdges:    make(map[compTypeId]*archetype),
+		removeEdges: make(map[compTypeId]*archetype),
+	}
+
+	for i := 0; i < len(compTypeIds); i++ {
+		arch.mask.Set(compTypeIds[i])
+		arch.columns[i] = w.compTypeCols[compTypeIds[i]].newEmpty()
+		arch.colIndices[compTypeIds[i]] = i
+	}
+
+	w.archetypes = append(w.archetypes, arch)
+	w.archetypesByID[id] = arch
+	return arch
+}
+
+func (w *World) archetypeWith(src *archetype, id compTypeId) *archetype {
+
+	if dst, ok := src.addEdges[id]; ok {
+		return dst
+	}
+
+	ids := make([]compTypeId, 0, len(src.compTypeIds)+1)
+	ids = append(ids, src.compTypeIds...)
+	ids = append(ids, id)
+
+	dst := w.getOrCreateArchetype(ids)
+	src.addEdges[id] = dst
+	dst.removeEdges[id] = src
+	return dst
+}
+
+func (w *World) archetypeWithout(src *archetype, id compTypeId) *archetype {
+
+	if dst, ok := src.removeEdges[id]; ok {
+		return dst
+	}
+
+	ids := make([]compTypeId, 0, len(src.compTypeIds))
+	for i := 0; i < len(src.compTypeIds); i++ {
+		if src.compTypeIds[i] != id {
+			ids = append(ids, src.compTypeIds[i])
+		}
+	}
+
+	dst := w.getOrCreateArchetype(ids)
+	src.removeEdges[id] = dst
+	dst.addEdges[id] = src
+	return dst
+}
+
+// getCompTypeId returns the id of the component type, registering it on first use
+func getCompTypeId[T any](w *World) compTypeId {
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if id, ok := w.compTypes[t]; ok {
+		return id
+	}
+
+	assert.T(len(w.compTypeCols) < MaxWorldCompTypes, "Can not register component type '%s' because the world already has the max of %d component types", t.String(), MaxWorldCompTypes)
+
+	id := compTypeId(len(w.compTypeCols))
+	w.compTypes[t] = id
+	w.compTypeCols = append(w.compTypeCols, &typedColumn[T]{})
+	return id
+}
+
+// SetComponent adds the component to the entity, or overwrites it if the entity already has one of this type
+func SetComponent[T any](w *World, h registry.Handle, c T) {
+
+	rec := w.entities.Get(h)
+	assert.T(rec != nil, "Can not set component of type '%T' because entity with handle '%v' is not alive", c, h)
+
+	id := getCompTypeId[T](w)
+	if colIndex, ok := rec.arch.colIndices[id]; ok {
+		rec.arch.columns[colIndex].(*typedColumn[T]).data[rec.row] = c
+		return
+	}
+
+	w.assertNotQuerying()
+
+	dst := w.archetypeWith(rec.arch, id)
+	w.moveEntity(h, rec, dst)
+
+	col := dst.columns[dst.colIndices[id]].(*typedColumn[T])
+	col.data = append(col.data, c)
+}
+
+// GetComponent returns a pointer to the component of the entity, or nil if the entity is not alive or doesn't have this component
+func GetComponent[T any](w *World, h registry.Handle) *T {
+
+	rec := w.entities.Get(h)
+	if rec == nil {
+		return nil
+	}
+
+	id := getCompTypeId[T](w)
+	colIndex, ok := rec.arch.colIndices[id]
+	if !ok {
+		return nil
+	}
+
+	return &rec.arch.columns[colIndex].(*typedColumn[T]).data[rec.row]
+}
+
+func HasComponent[T any](w *World, h registry.Handle) bool {
+
+	rec := w.entities.Get(h)
+	if rec == nil {
+		return false
+	}
+
+	return rec.arch.mask.Has(getCompTypeId[T](w))
+}
+
+// RemoveComponent removes the component from the entity. Does nothing if the entity doesn't have it
+func RemoveComponent[T any](w *World, h registry.Handle) {
+
+	rec := w.entities.Get(h)
+	if rec == nil {
+		return
+	}
+
+	id := getCompTypeId[T](w)
+	if !rec.arch.mask.Has(id) {
+		return
+	}
+
+	w.assertNotQuerying()
+	w.moveEntity(h, rec, w.archetypeWithout(rec.arch, id))
+}
@@ -0,0 +1,141 @@
+package entity
+
+import (
+	"github.com/bloeys/nmage/registry"
+)
+
+// queryCache keeps the list of archetypes matching a query.
+// Archetypes are never removed from a world, so only newly created archetypes need to be checked
+type queryCache struct {
+	world             *World
+	mask              compMask
+	archetypes        []*archetype
+	checkedArchetypes int
+}
+
+func (qc *queryCache) update() {
+
+	for ; qc.checkedArchetypes < len(qc.world.archetypes); qc.checkedArchetypes++ {
+
+		arch := qc.world.archetypes[qc.checkedArchetypes]
+		if arch.mask.HasAll(&qc.mask) {
+			qc.archetypes = append(qc.archetypes, arch)
+		}
+	}
+}
+
+func newQueryCache(w *World, ids ...compTypeId) queryCache {
+
+	qc := queryCache{
+		world:      w,
+		archetypes: make([]*archetype, 0),
+	}
+
+	for i := 0; i < len(ids); i++ {
+		qc.mask.Set(ids[i])
+	}
+
+	return qc
+}
+
+// Query1 iterates over all entities that have a component of type A
+type Query1[A any] struct {
+	qc  queryCache
+	idA compTypeId
+}
+
+func NewQuery1[A any](w *World) *Query1[A] {
+	idA := getCompTypeId[A](w)
+	return &Query1[A]{
+		qc:  newQueryCache(w, idA),
+		idA: idA,
+	}
+}
+
+// Each calls fn for every matching entity. Entities and components can NOT be added or removed from within fn
+func (q *Query1[A]) Each(fn func(h registry.Handle, a *A)) {
+
+	q.qc.update()
+	q.qc.world.runningQueries++
+	defer func() { q.qc.world.runningQueries-- }()
+
+	for _, arch := range q.qc.archetypes {
+
+		as := arch.columns[arch.colIndices[q.idA]].(*typedColumn[A]).data
+		for i := 0; i < len(arch.entities); i++ {
+			fn(arch.entities[i], &as[i])
+		}
+	}
+}
+
+// Query2 iterates over all entities that have components of types A and B
+type Query2[A, B any] struct {
+	qc  queryCache
+	idA compTypeId
+	idB compTypeId
+}
+
+func NewQuery2[A, B any](w *World) *Query2[A, B] {
+	idA := getCompTypeId[A](w)
+	idB := getCompTypeId[B](w)
+	return &Query2[A, B]{
+		qc:  newQueryCache(w, idA, idB),
+		idA: idA,
+		idB: idB,
+	}
+}
+
+// Each calls fn for every matching entity. Entities and components can NOT be added or removed from within fn
+func (q *Query2[A, B]) Each(fn func(h registry.Handle, a *A, b *B)) {
+
+	q.qc.update()
+	q.qc.world.runningQueries++
+	defer func() { q.qc.world.runningQueries-- }()
+
+	for _, arch := range q.qc.archetypes {
+
+		as := arch.columns[arch.colIndices[q.idA]].(*typedColumn[A]).data
+		bs := arch.columns[arch.colIndices[q.idB]].(*typedColumn[B]).data
+		for i := 0; i < len(arch.entities); i++ {
+			fn(arch.entities[i], &as[i], &bs[i])
+		}
+	}
+}
+
+// Query3 iterates over all entities that have components of types A, B and C
+type Query3[A, B, C any] struct {
+	qc  queryCache
+	idA compTypeId
+	idB compTypeId
+	idC compTypeId
+}
+
+func NewQuery3[A, B, C any](w *World) *Query3[A, B, C] {
+	idA := getCompTypeId[A](w)
+	idB := getCompTypeId[B](w)
+	idC := getCompTypeId[C](w)
+	return &Query3[A, B, C]{
+		qc:  newQueryCache(w, idA, idB, idC),
+		idA: idA,
+		idB: idB,
+		idC: idC,
+	}
+}
+
+// Each calls fn for every matching entity. Entities and components can NOT be added or removed from within fn
+func (q *Query3[A, B, C]) Each(fn func(h registry.Handle, a *A, b *B, c *C)) {
+
+	q.qc.update()
+	q.qc.world.runningQueries++
+	defer func() { q.qc.world.runningQueries-- }()
+
+	for _, arch := range q.qc.archetypes {
+
+		as := arch.columns[arch.colIndices[q.idA]].(*typedColumn[A]).data
+		bs := arch.columns[arch.colIndices[q.idB]].(*typedColumn[B]).data
+		cs := arch.columns[arch.colIndices[q.idC]].(*typedColumn[C]).data
+		for i := 0; i < len(arch.entities); i++ {
+			fn(arch.entities[i], &as[i], &bs[i], &cs[i])
+		}
+	}
+}
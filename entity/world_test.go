@@ -0,0 +1,128 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/bloeys/nmage/registry"
+)
+
+const (
+	benchEntityCount = 10_000
+)
+
+type benchPos struct {
+	X, Y, Z float32
+}
+
+type benchVel struct {
+	X, Y, Z float32
+}
+
+type benchPosComp struct {
+	BaseComp
+	benchPos
+}
+
+type benchVelComp struct {
+	BaseComp
+	benchVel
+}
+
+// Every other entity only has a position, so both approaches have entities to skip
+func newBenchWorld() *World {
+
+	w := NewWorld(benchEntityCount)
+	for i := 0; i < benchEntityCount; i++ {
+
+		h, _ := w.NewEntity()
+		SetComponent(w, h, benchPos{})
+		if i%2 == 0 {
+			SetComponent(w, h, benchVel{X: 1, Y: 1, Z: 1})
+		}
+	}
+
+	return w
+}
+
+func newBenchCompContainers() []CompContainer {
+
+	containers := make([]CompContainer, benchEntityCount)
+	for i := 0; i < benchEntityCount; i++ {
+
+		h := registry.NewHandle(1, uint64(i))
+		containers[i] = NewCompContainer()
+		AddComp(h, &containers[i], &benchPosComp{})
+		if i%2 == 0 {
+			AddComp(h, &containers[i], &benchVelComp{benchVel: benchVel{X: 1, Y: 1, Z: 1}})
+		}
+	}
+
+	return containers
+}
+
+func BenchmarkWorldQuery2(b *testing.B) {
+
+	w := newBenchWorld()
+	q := NewQuery2[benchPos, benchVel](w)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q.Each(func(h registry.Handle, p *benchPos, v *benchVel) {
+			p.X += v.X
+			p.Y += v.Y
+			p.Z += v.Z
+		})
+	}
+}
+
+func BenchmarkCompContainerGetComp(b *testing.B) {
+
+	containers := newBenchCompContainers()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(containers); j++ {
+
+			v := GetComp[*benchVelComp](&containers[j])
+			if v == nil {
+				continue
+			}
+
+			p := GetComp[*benchPosComp](&containers[j])
+			p.X += v.X
+			p.Y += v.Y
+			p.Z += v.Z
+		}
+	}
+}
+
+// BenchmarkCompContainerScan goes through the components of each container instead of using the type index of GetComp
+func BenchmarkCompContainerScan(b *testing.B) {
+
+	containers := newBenchCompContainers()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < len(containers); j++ {
+
+			var p *benchPosComp
+			var v *benchVelComp
+			for _, c := range containers[j].Comps {
+				switch typedComp := c.(type) {
+				case *benchPosComp:
+					p = typedComp
+				case *benchVelComp:
+					v = typedComp
+				}
+			}
+
+			if p == nil || v == nil {
+				continue
+			}
+
+			p.X += v.X
+			p.Y += v.Y
+			p.Z += v.Z
+		}
+	}
+}
@@ -60,6 +60,28 @@ func EventLoopStart() {
 	quitRequested = false
 }
 
+// HandleEvent passes the event to the matching Handle* function, and returns false if it is not an event the input package handles.
+// This is useful for injecting synthetic events, like when running headless
+func HandleEvent(event sdl.Event) bool {
+
+	switch e := event.(type) {
+	case *sdl.KeyboardEvent:
+		HandleKeyboardEvent(e)
+	case *sdl.MouseButtonEvent:
+		HandleMouseBtnEvent(e)
+	case *sdl.MouseMotionEvent:
+		HandleMouseMotionEvent(e)
+	case *sdl.MouseWheelEvent:
+		HandleMouseWheelEvent(e)
+	case *sdl.QuitEvent:
+		HandleQuitEvent(e)
+	default:
+		return false
+	}
+
+	return true
+}
+
 func HandleQuitEvent(e *sdl.QuitEvent) {
 	quitRequested = true
 }
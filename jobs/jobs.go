@@ -0,0 +1,341 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/logging"
+)
+
+var (
+	ErrJobPanicked = errors.New("job panicked")
+)
+
+// Job is a function run on a worker of a pool. A job only starts after all its dependencies are done.
+//
+// A job that panics is still marked as done (so dependents still run and waits don't block forever), and Err returns the panic
+type Job struct {
+	fn   func()
+	pool *Pool
+
+	// pendingDeps starts at one so the job can't be queued while its dependencies are still being registered
+	pendingDeps int32
+
+	lock       sync.Mutex
+	isDone     bool
+	err        error
+	doneChan   chan struct{}
+	dependents []*Job
+}
+
+// IsDone is safe to call from any goroutine
+func (j *Job) IsDone() bool {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.isDone
+}
+
+// Err returns an error wrapping ErrJobPanicked if the job function panicked, and nil otherwise or if the job is not done yet
+func (j *Job) Err() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.err
+}
+
+// Wait blocks until the job is done
+func (j *Job) Wait() {
+	<-j.doneChan
+}
+
+// Done returns a channel that is closed once the job is done
+func (j *Job) Done() <-chan struct{} {
+	return j.doneChan
+}
+
+// run calls the job function and then finishes the job, even if the function panics
+func (j *Job) run() {
+
+	var err error
+	defer func() {
+
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v\n%s", ErrJobPanicked, r, debug.Stack())
+			logging.ErrLog.Println(err)
+		}
+
+		j.finishWithErr(err)
+	}()
+
+	j.fn()
+}
+
+func (j *Job) finish() {
+	j.finishWithErr(nil)
+}
+
+func (j *Job) finishWithErr(err error) {
+
+	j.lock.Lock()
+	assert.T(!j.isDone, "Job finished twice")
+	j.isDone = true
+	j.err = err
+	dependents := j.dependents
+	j.dependents = nil
+	close(j.doneChan)
+	j.lock.Unlock()
+
+	for _, d := range dependents {
+		d.depDone()
+	}
+}
+
+func (j *Job) depDone() {
+
+	if atomic.AddInt32(&j.pendingDeps, -1) != 0 {
+		return
+	}
+
+	if j.pool == nil {
+		return
+	}
+
+	j.pool.enqueue(j)
+}
+
+// addDependency returns false if dep is already done, in which case j doesn't need to wait for it
+func (j *Job) addDependency(dep *Job) bool {
+
+	dep.lock.Lock()
+	defer dep.lock.Unlock()
+
+	if dep.isDone {
+		return false
+	}
+
+	atomic.AddInt32(&j.pendingDeps, 1)
+	dep.dependents = append(dep.dependents, j)
+	return true
+}
+
+func newJob(pool *Pool, fn func()) *Job {
+	return &Job{
+		fn:          fn,
+		pool:        pool,
+		pendingDeps: 1,
+		doneChan:    make(chan struct{}),
+		dependents:  make([]*Job, 0),
+	}
+}
+
+// Pool runs jobs on a fixed number of worker goroutines
+type Pool struct {
+	WorkerCount int
+
+	queueLock sync.Mutex
+	queueCond *sync.Cond
+	queue     []*Job
+	isClosed  bool
+
+	workersWg sync.WaitGroup
+}
+
+// Submit queues fn to run once all deps are done. Nil deps are ignored
+func (p *Pool) Submit(fn func(), deps ...*Job) *Job {
+
+	assert.T(fn != nil, "Job function can not be nil")
+
+	j := newJob(p, fn)
+	for _, dep := range deps {
+		if dep != nil {
+			j.addDependency(dep)
+		}
+	}
+
+	// Drop the registration count, which queues the job if all deps were already done
+	j.depDone()
+	return j
+}
+
+func (p *Pool) enqueue(j *Job) {
+
+	p.queueLock.Lock()
+	assert.T(!p.isClosed, "Can not run jobs on a closed pool")
+	p.queue = append(p.queue, j)
+	p.queueLock.Unlock()
+
+	p.queueCond.Signal()
+}
+
+func (p *Pool) worker() {
+
+	defer p.workersWg.Done()
+
+	for {
+
+		p.queueLock.Lock()
+		for len(p.queue) == 0 && !p.isClosed {
+			p.queueCond.Wait()
+		}
+
+		if len(p.queue) == 0 {
+			p.queueLock.Unlock()
+			return
+		}
+
+		j := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.queueLock.Unlock()
+
+		j.run()
+	}
+}
+
+// Close stops the workers once all queued jobs are done, and blocks until then.
+// Jobs waiting on dependencies that are not done yet must not exist when Close is called
+func (p *Pool) Close() {
+
+	p.queueLock.Lock()
+	p.isClosed = true
+	p.queueLock.Unlock()
+
+	p.queueCond.Broadcast()
+	p.workersWg.Wait()
+}
+
+// NewGroup creates a group whose jobs run on this pool
+func (p *Pool) NewGroup() *Group {
+	return &Group{
+		pool: p,
+		jobs: make([]*Job, 0),
+	}
+}
+
+// NewPool creates a pool with the passed number of workers. If workerCount is less than one then runtime.GOMAXPROCS(0) is used
+func NewPool(workerCount int) *Pool {
+
+	if workerCount < 1 {
+		workerCount = runtime.GOMAXPROCS(0)
+	}
+
+	p := &Pool{
+		WorkerCount: workerCount,
+		queue:       make([]*Job, 0, 64),
+	}
+	p.queueCond = sync.NewCond(&p.queueLock)
+
+	p.workersWg.Add(workerCount)
+	for i := 0; i < workerCount; i++ {
+		go p.worker()
+	}
+
+	return p
+}
+
+// Group tracks a set of jobs so they can be waited on together
+type Group struct {
+	pool *Pool
+
+	jobsLock sync.Mutex
+	jobs     []*Job
+}
+
+// Submit is like Pool.Submit, but the job is also added to the group
+func (g *Group) Submit(fn func(), deps ...*Job) *Job {
+
+	j := g.pool.Submit(fn, deps...)
+
+	g.jobsLock.Lock()
+	g.jobs = append(g.jobs, j)
+	g.jobsLock.Unlock()
+
+	return j
+}
+
+// Wait blocks until all jobs submitted to the group so far are done, and then removes them from the group.
+// The returned error is the error of the first of those jobs that panicked, if any
+func (g *Group) Wait() error {
+
+	g.jobsLock.Lock()
+	jobs := g.jobs
+	g.jobs = make([]*Job, 0, len(jobs))
+	g.jobsLock.Unlock()
+
+	var err error
+	for _, j := range jobs {
+
+		j.Wait()
+		if err == nil {
+			err = j.Err()
+		}
+	}
+
+	return err
+}
+
+// Future holds the result of work that finishes at a later time.
+// The embedded job can be used as a dependency of other jobs
+type Future[T any] struct {
+	*Job
+
+	val T
+	err error
+}
+
+// Complete sets the result and marks the future as done. Must be called exactly once, and only on futures created with NewFuture
+func (f *Future[T]) Complete(val T, err error) {
+	f.val = val
+	f.err = err
+	f.finish()
+}
+
+// Wait blocks until the future is done and then returns its result.
+// If the function of a future created by Go panicked then the error wraps ErrJobPanicked
+func (f *Future[T]) Wait() (T, error) {
+	f.Job.Wait()
+	return f.val, f.resultErr()
+}
+
+func (f *Future[T]) resultErr() error {
+
+	if f.err != nil {
+		return f.err
+	}
+
+	return f.Job.Err()
+}
+
+// Result returns the result without blocking. isDone is false if the future is not done yet
+func (f *Future[T]) Result() (val T, isDone bool, err error) {
+
+	if !f.IsDone() {
+		return val, false, nil
+	}
+
+	return f.val, true, f.resultErr()
+}
+
+// NewFuture creates a future that is done once Complete is called
+func NewFuture[T any]() *Future[T] {
+	return &Future[T]{
+		Job: newJob(nil, nil),
+	}
+}
+
+// Go runs fn on the pool once all deps are done, and returns a future of its result
+func Go[T any](p *Pool, fn func() (T, error), deps ...*Job) *Future[T] {
+
+	assert.T(fn != nil, "Job function can not be nil")
+
+	f := &Future[T]{}
+	f.Job = p.Submit(func() {
+		f.val, f.err = fn()
+	}, deps...)
+
+	return f
+}
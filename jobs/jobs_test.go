@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitTimeout fails the test instead of hanging if the job never finishes
+func waitTimeout(t *testing.T, j *Job) {
+
+	t.Helper()
+
+	select {
+	case <-j.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for job")
+	}
+}
+
+func TestJobDependencies(t *testing.T) {
+
+	p := NewPool(4)
+	defer p.Close()
+
+	order := make([]int, 0, 3)
+	orderLock := sync.Mutex{}
+	record := func(v int) {
+		orderLock.Lock()
+		order = append(order, v)
+		orderLock.Unlock()
+	}
+
+	a := p.Submit(func() {
+		time.Sleep(10 * time.Millisecond)
+		record(1)
+	})
+	b := p.Submit(func() { record(2) }, a)
+	c := p.Submit(func() { record(3) }, a, b, nil)
+
+	waitTimeout(t, c)
+
+	if len(order) != 3 || order[0] != 1 || order[1] != 2 || order[2] != 3 {
+		t.Fatalf("Expected jobs to run in dependency order [1 2 3], but got %v", order)
+	}
+
+	for _, j := range []*Job{a, b, c} {
+		if !j.IsDone() || j.Err() != nil {
+			t.Fatalf("Expected job to be done without error, but got isDone=%v, err=%v", j.IsDone(), j.Err())
+		}
+	}
+}
+
+func TestJobPanic(t *testing.T) {
+
+	// A single worker makes sure the worker that ran the panicking job is still alive
+	p := NewPool(1)
+	defer p.Close()
+
+	panicking := p.Submit(func() {
+		panic("job failed")
+	})
+
+	var dependentRan int32
+	dependent := p.Submit(func() {
+		atomic.StoreInt32(&dependentRan, 1)
+	}, panicking)
+
+	waitTimeout(t, dependent)
+
+	if !errors.Is(panicking.Err(), ErrJobPanicked) {
+		t.Fatalf("Expected job error to wrap ErrJobPanicked, but got %v", panicking.Err())
+	}
+
+	if atomic.LoadInt32(&dependentRan) != 1 || dependent.Err() != nil {
+		t.Fatalf("Expected dependent of a panicking job to run without error")
+	}
+
+	g := p.NewGroup()
+	g.Submit(func() {})
+	g.Submit(func() { panic("group job failed") })
+	g.Submit(func() {})
+
+	groupErr := make(chan error, 1)
+	go func() {
+		groupErr <- g.Wait()
+	}()
+
+	select {
+	case err := <-groupErr:
+		if !errors.Is(err, ErrJobPanicked) {
+			t.Fatalf("Expected group error to wrap ErrJobPanicked, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for group")
+	}
+
+	if err := g.Wait(); err != nil {
+		t.Fatalf("Expected waiting on an empty group to return no error, but got %v", err)
+	}
+
+	f := Go(p, func() (int, error) {
+		panic("future failed")
+	})
+	waitTimeout(t, f.Job)
+
+	if val, err := f.Wait(); val != 0 || !errors.Is(err, ErrJobPanicked) {
+		t.Fatalf("Expected future to return zero and an error wrapping ErrJobPanicked, but got %d and %v", val, err)
+	}
+
+	ok := Go(p, func() (int, error) {
+		return 5, nil
+	})
+
+	if val, err := ok.Wait(); val != 5 || err != nil {
+		t.Fatalf("Expected future to return 5 and no error, but got %d and %v", val, err)
+	}
+}
@@ -0,0 +1,65 @@
+package layers
+
+import (
+	"github.com/bloeys/nmage/assert"
+)
+
+const (
+	MaxLayers = 32
+)
+
+// Mask is a set of layers, where each bit is one layer
+type Mask uint32
+
+const (
+	Mask_None Mask = 0
+	Mask_All  Mask = 0xFFFF_FFFF
+
+	// Mask_Default is layer zero, which is the layer of entities that aren't assigned one
+	Mask_Default Mask = 1 << 0
+)
+
+var (
+	layerNames [MaxLayers]string
+)
+
+func init() {
+	layerNames[0] = "Default"
+}
+
+func (m Mask) Has(other Mask) bool {
+	return m&other == other
+}
+
+func (m Mask) Intersects(other Mask) bool {
+	return m&other != 0
+}
+
+// Layer returns the mask of the layer with the passed index
+func Layer(index uint8) Mask {
+	assert.T(index < MaxLayers, "Layer index must be less than %d, but got %d", MaxLayers, index)
+	return 1 << index
+}
+
+// SetLayerName names the layer with the passed index, so it can be found using ByName
+func SetLayerName(index uint8, name string) {
+	assert.T(index < MaxLayers, "Layer index must be less than %d, but got %d", MaxLayers, index)
+	layerNames[index] = name
+}
+
+func LayerName(index uint8) string {
+	assert.T(index < MaxLayers, "Layer index must be less than %d, but got %d", MaxLayers, index)
+	return layerNames[index]
+}
+
+// ByName returns the mask of the layer with the passed name
+func ByName(name string) (Mask, bool) {
+
+	for i := 0; i < len(layerNames); i++ {
+		if layerNames[i] == name && name != "" {
+			return 1 << i, true
+		}
+	}
+
+	return Mask_None, false
+}
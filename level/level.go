@@ -1,17 +1,235 @@
 package level
 
 import (
+	"github.com/bloeys/gglm/gglm"
 	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/camera"
+	"github.com/bloeys/nmage/entity"
+	"github.com/bloeys/nmage/registry"
 )
 
+const (
+	defaultEntityChunkSize = 256
+)
+
+type LightType int32
+
+const (
+	LightType_Unknown LightType = iota
+	LightType_Point
+	LightType_Directional
+)
+
+type Light struct {
+	Name      string    `json:"name"`
+	Type      LightType `json:"type"`
+	Pos       gglm.Vec3 `json:"pos"`
+	Dir       gglm.Vec3 `json:"dir"`
+	Color     gglm.Vec3 `json:"color"`
+	Intensity float32   `json:"intensity"`
+}
+
+type AssetType string
+
+const (
+	AssetType_Texture  AssetType = "texture"
+	AssetType_Cubemap  AssetType = "cubemap"
+	AssetType_Mesh     AssetType = "mesh"
+	AssetType_Material AssetType = "material"
+)
+
+// AssetRef is a reference to an asset used by the level. Assets are not loaded by the level itself
+type AssetRef struct {
+	Type  AssetType `json:"type"`
+	Name  string    `json:"name"`
+	Paths []string  `json:"paths"`
+}
+
+type NamedCamera struct {
+	Name string
+	Cam  *camera.Camera
+}
+
+// LevelEntity is an entity owned by a level
+type LevelEntity struct {
+	Name  string
+	Comps entity.CompContainer
+}
+
+// Level owns entities and their components, as well as the cameras, lights and asset references used by the level
 type Level struct {
 	Name string
+
+	Entities *registry.Registry[LevelEntity]
+	Meta     *entity.EntityMetaStore
+
+	Cameras []NamedCamera
+	Lights  []Light
+	Assets  []AssetRef
+
+	// deferredComps are added to their entities by AddDeferredComps, in the order they were deferred
+	deferredComps []deferredComp
+}
+
+type deferredComp struct {
+	handle registry.Handle
+	comp   entity.Comp
+}
+
+// NewEntity creates an entity with no components
+func (l *Level) NewEntity(name string) (registry.Handle, *LevelEntity, error) {
+
+	e, handle, err := l.Entities.New()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	e.Name = name
+	e.Comps = entity.NewCompContainer()
+	return handle, e, nil
+}
+
+// AddCompDeferred queues the component to be added to the entity on the next call to AddDeferredComps.
+//
+// This is used when building a level off the main thread, since adding a component calls its Init and OnEnable,
+// which might use things that are only safe on the main thread (e.g. the GL context or an event bus)
+func (l *Level) AddCompDeferred(h registry.Handle, c entity.Comp) {
+	l.deferredComps = append(l.deferredComps, deferredComp{handle: h, comp: c})
+}
+
+// AddDeferredComps adds all components queued using AddCompDeferred. Components of entities destroyed since are dropped
+func (l *Level) AddDeferredComps() {
+
+	for i := 0; i < len(l.deferredComps); i++ {
+
+		dc := l.deferredComps[i]
+		l.deferredComps[i] = deferredComp{}
+
+		e := l.Entities.Get(dc.handle)
+		if e == nil {
+			continue
+		}
+
+		entity.AddComp(dc.handle, &e.Comps, dc.comp)
+	}
+
+	l.deferredComps = l.deferredComps[:0]
+}
+
+// DestroyEntity destroys all components of the entity and then frees it.
+//
+// It is safe to call this from within a component update of the entity, in which case destroyed components
+// stay in the container until it finishes updating, and the entity is only freed once UpdateEntities is done
+func (l *Level) DestroyEntity(h registry.Handle) {
+
+	e := l.Entities.Get(h)
+	if e == nil {
+		return
+	}
+
+	// Destroy callbacks might destroy other components of the entity, so the index is clamped every step
+	for i := len(e.Comps.Comps) - 1; i >= 0; i-- {
+
+		if i >= len(e.Comps.Comps) {
+			i = len(e.Comps.Comps)
+			continue
+		}
+
+		c := e.Comps.Comps[i]
+		if !entity.IsCompAlive(c) {
+			continue
+		}
+
+		entity.DestroyCompInstance(&e.Comps, c)
+	}
+
+	l.Meta.Remove(h)
+
+	// Freeing now would let a new entity reuse the slot while the container of this one is still being updated
+	if e.Comps.IsUpdating() {
+		l.Entities.FreeDeferred(h)
+		return
+	}
+
+	l.Entities.Free(h)
+}
+
+// Clear destroys all entities and removes all cameras, lights and asset references.
+// Deferred components that were never added are dropped without being destroyed, since they were never initialized
+func (l *Level) Clear() {
+
+	l.deferredComps = l.deferredComps[:0]
+
+	handles := make([]registry.Handle, 0, l.Entities.ItemCount)
+	it := l.Entities.NewIterator()
+	for _, handle := it.Next(); !it.IsDone(); _, handle = it.Next() {
+		handles = append(handles, handle)
+	}
+
+	for _, h := range handles {
+		l.DestroyEntity(h)
+	}
+
+	l.Cameras = l.Cameras[:0]
+	l.Lights = l.Lights[:0]
+	l.Assets = l.Assets[:0]
+}
+
+// UpdateEntities updates the components of all entities, and then frees the entities destroyed during the update
+func (l *Level) UpdateEntities() {
+
+	it := l.Entities.NewIterator()
+	for e, _ := it.Next(); !it.IsDone(); e, _ = it.Next() {
+		entity.UpdateComps(&e.Comps)
+	}
+
+	l.Entities.FlushDeferred()
+}
+
+// ForEachSeenBy calls fn for every entity on at least one of the layers the camera renders (i.e. its CullingMask).
+// Entities without stored meta are on the default layer. Renderers should use this to pick what to draw for a camera.
+//
+// Entities must not be created or freed from within fn
+func (l *Level) ForEachSeenBy(cam *camera.Camera, fn func(h registry.Handle, e *LevelEntity)) {
+
+	it := l.Entities.NewIterator()
+	for e, h := it.Next(); !it.IsDone(); e, h = it.Next() {
+
+		if !cam.SeesLayers(l.Meta.GetLayers(h)) {
+			continue
+		}
+
+		fn(h, e)
+	}
+}
+
+func (l *Level) AddCamera(name string, cam *camera.Camera) {
+	l.Cameras = append(l.Cameras, NamedCamera{Name: name, Cam: cam})
+}
+
+// GetCamera returns the first camera with the passed name, or nil if there is none
+func (l *Level) GetCamera(name string) *camera.Camera {
+
+	for i := 0; i < len(l.Cameras); i++ {
+		if l.Cameras[i].Name == name {
+			return l.Cameras[i].Cam
+		}
+	}
+
+	return nil
 }
 
 func NewLevel(name string) *Level {
 
 	assert.T(name != "", "Level name can not be empty")
 	return &Level{
-		Name: name,
+		Name:     name,
+		Entities: registry.NewRegistry[LevelEntity](defaultEntityChunkSize),
+		Meta:     entity.NewEntityMetaStore(),
+		Cameras:  make([]NamedCamera, 0),
+		Lights:   make([]Light, 0),
+		Assets:   make([]AssetRef, 0),
+
+		deferredComps: make([]deferredComp, 0),
 	}
 }
@@ -0,0 +1,155 @@
+package level
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/bloeys/nmage/camera"
+	"github.com/bloeys/nmage/entity"
+	"github.com/bloeys/nmage/layers"
+	"github.com/bloeys/nmage/registry"
+)
+
+type selfDestroyComp struct {
+	entity.BaseComp
+
+	level        *Level
+	updateCount  int
+	destroyCount int
+}
+
+func (c *selfDestroyComp) Update() {
+	c.updateCount++
+	c.level.DestroyEntity(c.Handle)
+}
+
+func (c *selfDestroyComp) Destroy() {
+	c.destroyCount++
+}
+
+func TestDestroyEntityDuringUpdate(t *testing.T) {
+
+	l := NewLevel("test-destroy")
+
+	h, e, err := l.NewEntity("self destroying")
+	if err != nil {
+		t.Fatalf("Failed to create entity. Err: %v", err)
+	}
+
+	first := &selfDestroyComp{level: l}
+	second := &selfDestroyComp{level: l}
+	entity.AddComp(h, &e.Comps, first)
+	entity.AddComp(h, &e.Comps, second)
+
+	otherHandle, _, err := l.NewEntity("other")
+	if err != nil {
+		t.Fatalf("Failed to create entity. Err: %v", err)
+	}
+
+	l.UpdateEntities()
+
+	if first.updateCount != 1 || second.updateCount != 0 {
+		t.Fatalf("Expected only the first component to update, but got update counts %d and %d", first.updateCount, second.updateCount)
+	}
+
+	if first.destroyCount != 1 || second.destroyCount != 1 {
+		t.Fatalf("Expected each component to be destroyed once, but got destroy counts %d and %d", first.destroyCount, second.destroyCount)
+	}
+
+	if l.Entities.Get(h) != nil {
+		t.Fatalf("Expected the entity to be freed once the update is done")
+	}
+
+	if l.Entities.Get(otherHandle) == nil || l.Entities.ItemCount != 1 {
+		t.Fatalf("Expected only the destroyed entity to be freed")
+	}
+}
+
+func TestDestroyEntity(t *testing.T) {
+
+	l := NewLevel("test-destroy")
+
+	handles := make([]registry.Handle, 0, 3)
+	comps := make([]*selfDestroyComp, 0, 6)
+	for i := 0; i < 3; i++ {
+
+		h, e, err := l.NewEntity("entity")
+		if err != nil {
+			t.Fatalf("Failed to create entity. Err: %v", err)
+		}
+
+		for j := 0; j < 2; j++ {
+			c := &selfDestroyComp{level: l}
+			entity.AddComp(h, &e.Comps, c)
+			comps = append(comps, c)
+		}
+
+		handles = append(handles, h)
+	}
+
+	l.DestroyEntity(handles[1])
+	if l.Entities.Get(handles[1]) != nil || l.Entities.ItemCount != 2 {
+		t.Fatalf("Expected the entity to be freed immediately when not updating")
+	}
+
+	l.Clear()
+	if l.Entities.ItemCount != 0 {
+		t.Fatalf("Expected no entities after Clear, but got %d", l.Entities.ItemCount)
+	}
+
+	for i, c := range comps {
+		if c.destroyCount != 1 {
+			t.Fatalf("Expected component %d to be destroyed once, but got %d", i, c.destroyCount)
+		}
+	}
+}
+
+func TestForEachSeenBy(t *testing.T) {
+
+	l := NewLevel("test-culling")
+
+	newEntity := func(name string) registry.Handle {
+
+		h, _, err := l.NewEntity(name)
+		if err != nil {
+			t.Fatalf("Failed to create entity. Err: %v", err)
+		}
+
+		return h
+	}
+
+	newEntity("no meta")
+	l.Meta.AddTag(newEntity("tagged default"), entity.InternTag("test-culling"))
+	l.Meta.SetLayers(newEntity("ui"), layers.Layer(5))
+	l.Meta.SetLayers(newEntity("ui and default"), layers.Layer(5)|layers.Mask_Default)
+	l.Meta.SetLayers(newEntity("nothing"), layers.Mask_None)
+
+	seenBy := func(mask layers.Mask) []string {
+
+		cam := &camera.Camera{CullingMask: mask}
+		names := make([]string, 0)
+		l.ForEachSeenBy(cam, func(h registry.Handle, e *LevelEntity) {
+			names = append(names, e.Name)
+		})
+
+		sort.Strings(names)
+		return names
+	}
+
+	checks := []struct {
+		mask     layers.Mask
+		expected []string
+	}{
+		{layers.Mask_Default, []string{"no meta", "tagged default", "ui and default"}},
+		{layers.Layer(5), []string{"ui", "ui and default"}},
+		{layers.Mask_All, []string{"no meta", "tagged default", "ui", "ui and default"}},
+		{layers.Mask_None, []string{}},
+	}
+
+	for _, c := range checks {
+		if got := seenBy(c.mask); !reflect.DeepEqual(got, c.expected) {
+			t.Fatalf("Expected camera with mask %b to see %v, but got %v", c.mask, c.expected, got)
+		}
+	}
+}
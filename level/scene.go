@@ -0,0 +1,347 @@
+package level
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nmage/camera"
+	"github.com/bloeys/nmage/entity"
+	"github.com/bloeys/nmage/layers"
+	"github.com/bloeys/nmage/registry"
+)
+
+const (
+	sceneFileVersion = 1
+)
+
+var (
+	ErrInvalidScene = errors.New("invalid scene file")
+)
+
+// sceneFile is the JSON layout of a saved level.
+//
+// Entities are given ids that are only used within the file (e.g. for parents), as handles are not stable across runs
+type sceneFile struct {
+	Version  int           `json:"version"`
+	Name     string        `json:"name"`
+	Assets   []AssetRef    `json:"assets"`
+	Cameras  []sceneCamera `json:"cameras"`
+	Lights   []Light       `json:"lights"`
+	Entities []sceneEntity `json:"entities"`
+}
+
+type sceneEntity struct {
+	Id     uint64            `json:"id"`
+	Name   string            `json:"name"`
+	Parent uint64            `json:"parent,omitempty"`
+	Tags   []string          `json:"tags,omitempty"`
+	Layers layers.Mask       `json:"layers"`
+	Comps  []json.RawMessage `json:"comps"`
+}
+
+type sceneCamera struct {
+	Name string      `json:"name"`
+	Type camera.Type `json:"type"`
+
+	Pos     gglm.Vec3 `json:"pos"`
+	Forward gglm.Vec3 `json:"forward"`
+	WorldUp gglm.Vec3 `json:"worldUp"`
+
+	NearClip float32 `json:"nearClip"`
+	FarClip  float32 `json:"farClip"`
+
+	Fov         float32 `json:"fov,omitempty"`
+	AspectRatio float32 `json:"aspectRatio,omitempty"`
+
+	Left   float32 `json:"left,omitempty"`
+	Right  float32 `json:"right,omitempty"`
+	Top    float32 `json:"top,omitempty"`
+	Bottom float32 `json:"bottom,omitempty"`
+
+	CullingMask layers.Mask `json:"cullingMask"`
+}
+
+// Save writes the level as a human readable JSON scene file. All component types must be registered.
+//
+// Loading a saved level using Load and saving it again produces identical output
+func (l *Level) Save(w io.Writer) error {
+
+	sf := sceneFile{
+		Version:  sceneFileVersion,
+		Name:     l.Name,
+		Assets:   l.Assets,
+		Cameras:  make([]sceneCamera, 0, len(l.Cameras)),
+		Lights:   l.Lights,
+		Entities: make([]sceneEntity, 0, l.Entities.ItemCount),
+	}
+
+	for _, nc := range l.Cameras {
+		c := nc.Cam
+		sf.Cameras = append(sf.Cameras, sceneCamera{
+			Name:        nc.Name,
+			Type:        c.Type,
+			Pos:         c.Pos,
+			Forward:     c.Forward,
+			WorldUp:     c.WorldUp,
+			NearClip:    c.NearClip,
+			FarClip:     c.FarClip,
+			Fov:         c.Fov,
+			AspectRatio: c.AspectRatio,
+			Left:        c.Left,
+			Right:       c.Right,
+			Top:         c.Top,
+			Bottom:      c.Bottom,
+			CullingMask: c.CullingMask,
+		})
+	}
+
+	// Ids are assigned first so parents can be referenced regardless of order
+	ids := make(map[registry.Handle]uint64, l.Entities.ItemCount)
+	it := l.Entities.NewIterator()
+	for _, handle := it.Next(); !it.IsDone(); _, handle = it.Next() {
+		ids[handle] = uint64(len(ids) + 1)
+	}
+
+	it = l.Entities.NewIterator()
+	for e, handle := it.Next(); !it.IsDone(); e, handle = it.Next() {
+
+		se := sceneEntity{
+			Id:     ids[handle],
+			Name:   e.Name,
+			Layers: l.Meta.GetLayers(handle),
+			Comps:  make([]json.RawMessage, 0, len(e.Comps.Comps)),
+		}
+
+		if meta := l.Meta.Get(handle); meta != nil && len(meta.Tags) > 0 {
+
+			se.Tags = make([]string, len(meta.Tags))
+			for i, tag := range meta.Tags {
+				se.Tags[i] = tag.String()
+			}
+		}
+
+		if tr := entity.GetComp[*entity.TransformComp](&e.Comps); tr != nil && tr.Parent() != nil {
+
+			parentId, ok := ids[tr.ParentHandle()]
+			if !ok {
+				return fmt.Errorf("entity '%s' has a parent that is not part of level '%s'", e.Name, l.Name)
+			}
+
+			se.Parent = parentId
+		}
+
+		for _, c := range e.Comps.Comps {
+
+			if !entity.IsCompAlive(c) {
+				continue
+			}
+
+			data, err := entity.MarshalComp(c)
+			if err != nil {
+				return fmt.Errorf("failed to save entity '%s'. Err: %w", e.Name, err)
+			}
+
+			se.Comps = append(se.Comps, data)
+		}
+
+		sf.Entities = append(sf.Entities, se)
+	}
+
+	data, err := json.MarshalIndent(sf, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func (l *Level) SaveFile(path string) error {
+
+	buf := &bytes.Buffer{}
+	err := l.Save(buf)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// Load creates a level from a scene file written by Level.Save
+func Load(r io.Reader) (*Level, error) {
+	return LoadWithProgress(r, nil)
+}
+
+// LoadWithProgress is like Load but calls onProgress (if not nil) with values in the range [0, 1] as loading advances.
+// Components are added while loading, so this must be called on the main thread. Use LoadDeferred to load on other goroutines
+func LoadWithProgress(r io.Reader, onProgress func(progress float32)) (*Level, error) {
+	return load(r, onProgress, false)
+}
+
+// LoadDeferred is like LoadWithProgress, but components are queued using Level.AddCompDeferred instead of being added.
+// This makes it safe to call from any goroutine, as no component code runs while loading.
+//
+// Level.AddDeferredComps must be called on the main thread before the level is used
+func LoadDeferred(r io.Reader, onProgress func(progress float32)) (*Level, error) {
+	return load(r, onProgress, true)
+}
+
+func load(r io.Reader, onProgress func(progress float32), deferComps bool) (*Level, error) {
+
+	reportProgress := func(progress float32) {
+		if onProgress != nil {
+			onProgress(progress)
+		}
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	reportProgress(0.1)
+
+	sf := sceneFile{}
+	err = json.Unmarshal(data, &sf)
+	if err != nil {
+		return nil, err
+	}
+
+	reportProgress(0.2)
+
+	if sf.Version != sceneFileVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidScene, sf.Version)
+	}
+
+	if sf.Name == "" {
+		return nil, fmt.Errorf("%w: level name can not be empty", ErrInvalidScene)
+	}
+
+	l := NewLevel(sf.Name)
+	if sf.Assets != nil {
+		l.Assets = sf.Assets
+	}
+
+	if sf.Lights != nil {
+		l.Lights = sf.Lights
+	}
+
+	for _, sc := range sf.Cameras {
+
+		cam := &camera.Camera{
+			Type:        sc.Type,
+			Pos:         sc.Pos,
+			Forward:     sc.Forward,
+			WorldUp:     sc.WorldUp,
+			NearClip:    sc.NearClip,
+			FarClip:     sc.FarClip,
+			Fov:         sc.Fov,
+			AspectRatio: sc.AspectRatio,
+			Left:        sc.Left,
+			Right:       sc.Right,
+			Top:         sc.Top,
+			Bottom:      sc.Bottom,
+			CullingMask: sc.CullingMask,
+		}
+		cam.Update()
+
+		l.AddCamera(sc.Name, cam)
+	}
+
+	handles := make(map[uint64]registry.Handle, len(sf.Entities))
+
+	// Transforms are tracked here because deferred components are not in the entity containers yet
+	transforms := make(map[uint64]*entity.TransformComp, len(sf.Entities))
+	for i, se := range sf.Entities {
+
+		if _, ok := handles[se.Id]; ok || se.Id == 0 {
+			return nil, fmt.Errorf("%w: entity '%s' has invalid or duplicate id %d", ErrInvalidScene, se.Name, se.Id)
+		}
+
+		handle, e, err := l.NewEntity(se.Name)
+		if err != nil {
+			return nil, err
+		}
+		handles[se.Id] = handle
+
+		for _, tag := range se.Tags {
+			l.Meta.AddTag(handle, entity.InternTag(tag))
+		}
+		l.Meta.SetLayers(handle, se.Layers)
+
+		for _, compData := range se.Comps {
+
+			c, err := entity.UnmarshalComp(compData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load entity '%s'. Err: %w", se.Name, err)
+			}
+
+			if tr, ok := c.(*entity.TransformComp); ok && transforms[se.Id] == nil {
+				transforms[se.Id] = tr
+			}
+
+			if deferComps {
+				l.AddCompDeferred(handle, c)
+			} else {
+				entity.AddComp(handle, &e.Comps, c)
+			}
+		}
+
+		// Entities are the bulk of the work, so they get most of the progress range
+		reportProgress(0.2 + 0.7*float32(i+1)/float32(len(sf.Entities)))
+	}
+
+	// Parents are set after all entities exist. Transforms were saved with local values, so world values are not kept
+	for _, se := range sf.Entities {
+
+		if se.Parent == 0 {
+			continue
+		}
+
+		if _, ok := handles[se.Parent]; !ok {
+			return nil, fmt.Errorf("%w: entity '%s' has unknown parent id %d", ErrInvalidScene, se.Name, se.Parent)
+		}
+
+		childTr := transforms[se.Id]
+		parentTr := transforms[se.Parent]
+		if childTr == nil || parentTr == nil {
+			return nil, fmt.Errorf("%w: entity '%s' has a parent but it or its parent has no transform", ErrInvalidScene, se.Name)
+		}
+
+		childTr.SetParent(parentTr, false)
+	}
+
+	reportProgress(1)
+	return l, nil
+}
+
+func LoadFile(path string) (*Level, error) {
+	return LoadFileWithProgress(path, nil)
+}
+
+func LoadFileWithProgress(path string, onProgress func(progress float32)) (*Level, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadWithProgress(f, onProgress)
+}
+
+// LoadFileDeferred is the file version of LoadDeferred
+func LoadFileDeferred(path string, onProgress func(progress float32)) (*Level, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadDeferred(f, onProgress)
+}
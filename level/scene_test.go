@@ -0,0 +1,185 @@
+package level
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bloeys/gglm/gglm"
+	"github.com/bloeys/nmage/camera"
+	"github.com/bloeys/nmage/entity"
+	"github.com/bloeys/nmage/layers"
+	"github.com/bloeys/nmage/registry"
+)
+
+func newTestSceneLevel(t *testing.T) *Level {
+
+	l := NewLevel("test-scene")
+
+	l.Assets = append(l.Assets,
+		AssetRef{Type: AssetType_Texture, Name: "wall", Paths: []string{"res/textures/wall.png"}},
+		AssetRef{Type: AssetType_Cubemap, Name: "sky", Paths: []string{"res/sky/right.png", "res/sky/left.png"}},
+	)
+
+	l.Lights = append(l.Lights,
+		Light{Name: "sun", Type: LightType_Directional, Dir: *gglm.NewVec3(0, -1, 0.5), Color: *gglm.NewVec3(1, 0.9, 0.8), Intensity: 1.5},
+		Light{Name: "lamp", Type: LightType_Point, Pos: *gglm.NewVec3(3, 2, -1), Color: *gglm.NewVec3(1, 0, 0), Intensity: 0.25},
+	)
+
+	persp := camera.NewPerspective(gglm.NewVec3(0, 1, -10), gglm.NewVec3(0, 0, 1), gglm.NewVec3(0, 1, 0), 0.1, 200, 1.2, 16.0/9.0)
+	persp.CullingMask = layers.Mask_Default | layers.Layer(2)
+	l.AddCamera("main", persp)
+
+	ortho := camera.NewOrthographic(gglm.NewVec3(0, 0, 5), gglm.NewVec3(0, 0, -1), gglm.NewVec3(0, 1, 0), 0.1, 20, -8, 8, 4.5, -4.5)
+	ortho.CullingMask = layers.Layer(5)
+	l.AddCamera("ui", ortho)
+
+	newTransformEntity := func(name string, pos *gglm.Vec3, rot *gglm.Quat, scale *gglm.Vec3) (registry.Handle, *entity.TransformComp) {
+
+		h, e, err := l.NewEntity(name)
+		if err != nil {
+			t.Fatalf("Failed to create entity '%s'. Err: %v", name, err)
+		}
+
+		tr := entity.NewTransformComp(pos, rot, scale)
+		entity.AddComp(h, &e.Comps, tr)
+		return h, tr
+	}
+
+	// The child is created before the parent so that parent ids don't just follow entity order
+	childHandle, childTr := newTransformEntity("child", gglm.NewVec3(1, 0, 0), gglm.NewQuatEulerXYZ(0, 0.5, 0), gglm.NewVec3(1, 1, 1))
+	parentHandle, parentTr := newTransformEntity("parent", gglm.NewVec3(0, 5, 0), gglm.NewQuatEulerXYZ(0.25, 0, 0), gglm.NewVec3(2, 2, 2))
+	newTransformEntity("no meta", gglm.NewVec3(-1, -2, -3), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+	childTr.SetParent(parentTr, false)
+
+	l.Meta.AddTag(parentHandle, entity.InternTag("player"))
+	l.Meta.AddTag(parentHandle, entity.InternTag("hero"))
+	l.Meta.SetLayers(parentHandle, layers.Mask_Default|layers.Layer(2))
+
+	l.Meta.AddTag(childHandle, entity.InternTag("weapon"))
+	l.Meta.SetLayers(childHandle, layers.Layer(7))
+
+	// A disabled component must stay disabled
+	disabledHandle, e, err := l.NewEntity("disabled transform")
+	if err != nil {
+		t.Fatalf("Failed to create entity. Err: %v", err)
+	}
+
+	disabledTr := entity.NewTransformComp(gglm.NewVec3(0, 0, 0), gglm.NewQuatId(), gglm.NewVec3(1, 1, 1))
+	entity.AddComp(disabledHandle, &e.Comps, disabledTr)
+	entity.SetCompEnabled(disabledTr, false)
+
+	return l
+}
+
+func findEntityByName(l *Level, name string) (registry.Handle, *LevelEntity) {
+
+	it := l.Entities.NewIterator()
+	for e, h := it.Next(); !it.IsDone(); e, h = it.Next() {
+		if e.Name == name {
+			return h, e
+		}
+	}
+
+	return 0, nil
+}
+
+func TestSceneSaveLoadSave(t *testing.T) {
+
+	l := newTestSceneLevel(t)
+
+	first := &bytes.Buffer{}
+	err := l.Save(first)
+	if err != nil {
+		t.Fatalf("Failed to save level. Err: %v", err)
+	}
+
+	loaded, err := Load(bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to load level. Err: %v", err)
+	}
+
+	second := &bytes.Buffer{}
+	err = loaded.Save(second)
+	if err != nil {
+		t.Fatalf("Failed to save loaded level. Err: %v", err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatalf("Expected saving a loaded level to produce identical output.\nFirst save:\n%s\nSecond save:\n%s", first.String(), second.String())
+	}
+
+	// Check the loaded level itself and not just its output
+	if len(loaded.Cameras) != 2 || loaded.GetCamera("ui") == nil || loaded.GetCamera("ui").CullingMask != layers.Layer(5) {
+		t.Fatalf("Expected cameras to be loaded with their culling masks")
+	}
+
+	if len(loaded.Lights) != 2 || len(loaded.Assets) != 2 {
+		t.Fatalf("Expected 2 lights and 2 assets, but got %d and %d", len(loaded.Lights), len(loaded.Assets))
+	}
+
+	parentHandle, parent := findEntityByName(loaded, "parent")
+	childHandle, child := findEntityByName(loaded, "child")
+	if parent == nil || child == nil {
+		t.Fatalf("Expected parent and child entities to be loaded")
+	}
+
+	childTr := entity.GetComp[*entity.TransformComp](&child.Comps)
+	parentTr := entity.GetComp[*entity.TransformComp](&parent.Comps)
+	if childTr.Parent() != parentTr || childTr.ParentHandle() != parentHandle {
+		t.Fatalf("Expected child transform to be parented to the parent transform")
+	}
+
+	origChildHandle, origChild := findEntityByName(l, "child")
+	origChildTr := entity.GetComp[*entity.TransformComp](&origChild.Comps)
+	if !childTr.WorldPos().Eq(origChildTr.WorldPos()) {
+		t.Fatalf("Expected child world pos %s, but got %s", origChildTr.WorldPos().String(), childTr.WorldPos().String())
+	}
+
+	if !loaded.Meta.HasTag(parentHandle, entity.InternTag("player")) || !loaded.Meta.HasTag(parentHandle, entity.InternTag("hero")) {
+		t.Fatalf("Expected parent to have its tags")
+	}
+
+	if loaded.Meta.GetLayers(childHandle) != l.Meta.GetLayers(origChildHandle) {
+		t.Fatalf("Expected child layers %d, but got %d", l.Meta.GetLayers(origChildHandle), loaded.Meta.GetLayers(childHandle))
+	}
+
+	_, disabled := findEntityByName(loaded, "disabled transform")
+	if disabled == nil || entity.GetComp[*entity.TransformComp](&disabled.Comps).IsEnabled() {
+		t.Fatalf("Expected disabled transform to stay disabled")
+	}
+}
+
+func TestSceneLoadDeferred(t *testing.T) {
+
+	l := newTestSceneLevel(t)
+
+	saved := &bytes.Buffer{}
+	err := l.Save(saved)
+	if err != nil {
+		t.Fatalf("Failed to save level. Err: %v", err)
+	}
+
+	loaded, err := LoadDeferred(bytes.NewReader(saved.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("Failed to load level. Err: %v", err)
+	}
+
+	it := loaded.Entities.NewIterator()
+	for e, _ := it.Next(); !it.IsDone(); e, _ = it.Next() {
+		if len(e.Comps.Comps) != 0 {
+			t.Fatalf("Expected no components to be added before AddDeferredComps, but entity '%s' has %d", e.Name, len(e.Comps.Comps))
+		}
+	}
+
+	loaded.AddDeferredComps()
+
+	resaved := &bytes.Buffer{}
+	err = loaded.Save(resaved)
+	if err != nil {
+		t.Fatalf("Failed to save loaded level. Err: %v", err)
+	}
+
+	if !bytes.Equal(saved.Bytes(), resaved.Bytes()) {
+		t.Fatalf("Expected a deferred load to save identically.\nFirst save:\n%s\nSecond save:\n%s", saved.String(), resaved.String())
+	}
+}
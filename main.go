@@ -26,7 +26,6 @@ import (
 // Integrate physx
 // Create VAO struct independent from VBO to support multi-VBO use cases (e.g. instancing)
 // Renderer batching
-// Scene graph
 // Separate engine loop from rendering loop? or leave it to the user?
 // Abstract keys enum away from sdl
 // Proper Asset loading
@@ -73,41 +72,29 @@ type OurGame struct {
 	ImGUIInfo nmageimgui.ImguiInfo
 }
 
-type TransformComp struct {
-	entity.BaseComp
-
-	Pos   *gglm.Vec3
-	Rot   *gglm.Quat
-	Scale *gglm.Vec3
-}
-
-func (t *TransformComp) Name() string {
-	return "Transform Component"
-}
-
 func Test() {
 
 	// lvl := level.NewLevel("test level")
 	testRegistry := registry.NewRegistry[int](100)
 
-	e1, e1Handle := testRegistry.New()
+	e1, e1Handle, _ := testRegistry.New()
 	e1CompContainer := entity.NewCompContainer()
 	fmt.Printf("Entity 1: %+v; Handle: %+v; Index: %+v; Gen: %+v; Flags: %+v\n", e1, e1Handle, e1Handle.Index(), e1Handle.Generation(), e1Handle.Flags())
 
-	trComp := entity.GetComp[*TransformComp](&e1CompContainer)
+	trComp := entity.GetComp[*entity.TransformComp](&e1CompContainer)
 	fmt.Println("Get comp before adding any:", trComp)
 
-	entity.AddComp(e1Handle, &e1CompContainer, &TransformComp{
-		Pos:   gglm.NewVec3(0, 0, 0),
-		Rot:   gglm.NewQuatEulerXYZ(0, 0, 0),
-		Scale: gglm.NewVec3(0, 0, 0),
-	})
-	trComp = entity.GetComp[*TransformComp](&e1CompContainer)
+	entity.AddComp(e1Handle, &e1CompContainer, entity.NewTransformComp(
+		gglm.NewVec3(0, 0, 0),
+		gglm.NewQuatEulerXYZ(0, 0, 0),
+		gglm.NewVec3(1, 1, 1),
+	))
+	trComp = entity.GetComp[*entity.TransformComp](&e1CompContainer)
 	fmt.Println("Get transform comp:", trComp)
 
-	e2, e2Handle := testRegistry.New()
-	e3, e3Handle := testRegistry.New()
-	e4, e4Handle := testRegistry.New()
+	e2, e2Handle, _ := testRegistry.New()
+	e3, e3Handle, _ := testRegistry.New()
+	e4, e4Handle, _ := testRegistry.New()
 	fmt.Printf("Entity 2: %+v; Handle: %+v; Index: %+v; Gen: %+v; Flags: %+v\n", e2, e2Handle, e2Handle.Index(), e2Handle.Generation(), e2Handle.Flags())
 	fmt.Printf("Entity 3: %+v; Handle: %+v; Index: %+v; Gen: %+v; Flags: %+v\n", e3, e3Handle, e3Handle.Index(), e3Handle.Generation(), e3Handle.Flags())
 	fmt.Printf("Entity 4: %+v; Handle: %+v; Index: %+v; Gen: %+v; Flags: %+v\n", e4, e4Handle, e4Handle.Index(), e4Handle.Generation(), e4Handle.Flags())
@@ -118,7 +105,7 @@ func Test() {
 	testRegistry.Free(e2Handle)
 	fmt.Printf("Entity 2 value after free: %+v\n", testRegistry.Get(e2Handle))
 
-	e5, e5Handle := testRegistry.New()
+	e5, e5Handle, _ := testRegistry.New()
 	fmt.Printf("Entity 5: %+v; Handle: %+v; Index: %+v; Gen: %+v; Flags: %+v\n", e5, e5Handle, e5Handle.Index(), e5Handle.Generation(), e5Handle.Flags())
 }
 
@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"sync"
+)
+
+// ConcurrentRegistry is a registry that is safe to concurrently create, get and free items from.
+//
+// Besides immediate frees, handles can be queued for freeing using FreeDeferred, and those are only freed
+// when FlushDeferred is called. This is useful for freeing items at a known sync point (e.g. end of frame)
+// while other goroutines might still be using them.
+//
+// Note that while the registry itself is safe to use concurrently, the items returned by it are not protected
+// in any way, and its up to the caller to synchronize access to them
+type ConcurrentRegistry[T any] struct {
+	lock     sync.RWMutex
+	registry *Registry[T]
+
+	deferredLock  sync.Mutex
+	deferredFrees []Handle
+}
+
+func (cr *ConcurrentRegistry[T]) New() (*T, Handle, error) {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	return cr.registry.New()
+}
+
+func (cr *ConcurrentRegistry[T]) Get(id Handle) *T {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	return cr.registry.Get(id)
+}
+
+func (cr *ConcurrentRegistry[T]) Free(id Handle) {
+	cr.lock.Lock()
+	defer cr.lock.Unlock()
+	cr.registry.Free(id)
+}
+
+// FreeDeferred queues the handle to be freed on the next call to FlushDeferred.
+// The item stays alive and can be retrieved using Get until then
+func (cr *ConcurrentRegistry[T]) FreeDeferred(id Handle) {
+	cr.deferredLock.Lock()
+	cr.deferredFrees = append(cr.deferredFrees, id)
+	cr.deferredLock.Unlock()
+}
+
+// FlushDeferred frees all handles queued using FreeDeferred
+func (cr *ConcurrentRegistry[T]) FlushDeferred() {
+
+	cr.deferredLock.Lock()
+	toFree := cr.deferredFrees
+	cr.deferredFrees = cr.deferredFrees[:0:0]
+	cr.deferredLock.Unlock()
+
+	if len(toFree) == 0 {
+		return
+	}
+
+	cr.lock.Lock()
+	for i := 0; i < len(toFree); i++ {
+		cr.registry.Free(toFree[i])
+	}
+	cr.lock.Unlock()
+}
+
+func (cr *ConcurrentRegistry[T]) ItemCount() uint {
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	return cr.registry.ItemCount
+}
+
+// ForEach calls fn on every alive item while holding a read lock.
+//
+// fn must NOT call any method of the registry other than FreeDeferred. Even Get takes the read lock again,
+// which deadlocks if a writer started waiting in between, and New/Free always deadlock.
+// To free items from within fn use FreeDeferred, and to get other items collect their handles and get them after ForEach returns
+func (cr *ConcurrentRegistry[T]) ForEach(fn func(item *T, handle Handle)) {
+
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+
+	it := cr.registry.NewIterator()
+	for item, handle := it.Next(); !it.IsDone(); item, handle = it.Next() {
+		fn(item, handle)
+	}
+}
+
+func NewConcurrentRegistry[T any](size uint32) *ConcurrentRegistry[T] {
+	return &ConcurrentRegistry[T]{
+		registry: NewRegistry[T](size),
+	}
+}
+
+func NewConcurrentRegistryWithOptions[T any](opts *RegistryOptions) *ConcurrentRegistry[T] {
+	return &ConcurrentRegistry[T]{
+		registry: NewRegistryWithOptions[T](opts),
+	}
+}
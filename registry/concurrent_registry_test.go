@@ -0,0 +1,289 @@
+package registry
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentRegistry(t *testing.T) {
+
+	const workerCount = 8
+	const itemsPerWorker = 600
+
+	cr := NewConcurrentRegistry[int](64)
+
+	kept := make([][]Handle, workerCount)
+	deferred := make([][]Handle, workerCount)
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < workerCount; w++ {
+
+		wg.Add(1)
+		go func(w int) {
+
+			defer wg.Done()
+
+			for i := 0; i < itemsPerWorker; i++ {
+
+				item, h, err := cr.New()
+				if err != nil {
+					t.Errorf("Failed to create item. Err: %v", err)
+					return
+				}
+
+				val := w*itemsPerWorker + i
+				*item = val
+
+				got := cr.Get(h)
+				if got == nil || *got != val {
+					t.Errorf("Expected item with value %d for handle %v, but got %v", val, h, got)
+					return
+				}
+
+				switch i % 3 {
+				case 0:
+					cr.Free(h)
+					if cr.Get(h) != nil {
+						t.Errorf("Got item from freed handle %v", h)
+						return
+					}
+				case 1:
+					cr.FreeDeferred(h)
+					deferred[w] = append(deferred[w], h)
+				case 2:
+					kept[w] = append(kept[w], h)
+				}
+			}
+		}(w)
+	}
+
+	// Readers that run alongside the writers
+	stopReaders := make(chan struct{})
+	readersWg := sync.WaitGroup{}
+	for r := 0; r < 2; r++ {
+
+		readersWg.Add(1)
+		go func() {
+
+			defer readersWg.Done()
+			for {
+				select {
+				case <-stopReaders:
+					return
+				default:
+				}
+
+				count := uint(0)
+				cr.ForEach(func(item *int, handle Handle) {
+					count++
+				})
+
+				if count > workerCount*itemsPerWorker {
+					t.Errorf("ForEach visited %d items, but at most %d can exist", count, workerCount*itemsPerWorker)
+					return
+				}
+
+				// Holding the read lock nonstop would starve the writers
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(stopReaders)
+	readersWg.Wait()
+
+	for w := 0; w < workerCount; w++ {
+		for _, h := range deferred[w] {
+			if cr.Get(h) == nil {
+				t.Fatalf("Deferred free of handle %v happened before FlushDeferred", h)
+			}
+		}
+	}
+
+	expectedBeforeFlush := uint(workerCount * (itemsPerWorker / 3) * 2)
+	if cr.ItemCount() != expectedBeforeFlush {
+		t.Fatalf("Expected %d items before flushing, but got %d", expectedBeforeFlush, cr.ItemCount())
+	}
+
+	cr.FlushDeferred()
+
+	for w := 0; w < workerCount; w++ {
+
+		for _, h := range deferred[w] {
+			if cr.Get(h) != nil {
+				t.Fatalf("Handle %v is still alive after FlushDeferred", h)
+			}
+		}
+
+		for i, h := range kept[w] {
+			val := w*itemsPerWorker + i*3 + 2
+			if got := cr.Get(h); got == nil || *got != val {
+				t.Fatalf("Expected kept item with value %d for handle %v, but got %v", val, h, got)
+			}
+		}
+	}
+
+	expectedAfterFlush := uint(workerCount * (itemsPerWorker / 3))
+	if cr.ItemCount() != expectedAfterFlush {
+		t.Fatalf("Expected %d items after flushing, but got %d", expectedAfterFlush, cr.ItemCount())
+	}
+}
+
+const benchRegistrySize = 1024
+
+func BenchmarkRegistryNewFree(b *testing.B) {
+
+	r := NewRegistry[int](benchRegistrySize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h, _ := r.New()
+		r.Free(h)
+	}
+}
+
+func BenchmarkConcurrentRegistryNewFree(b *testing.B) {
+
+	cr := NewConcurrentRegistry[int](benchRegistrySize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, h, _ := cr.New()
+		cr.Free(h)
+	}
+}
+
+func BenchmarkConcurrentRegistryNewFreeParallel(b *testing.B) {
+
+	cr := NewConcurrentRegistry[int](benchRegistrySize)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, h, _ := cr.New()
+			cr.Free(h)
+		}
+	})
+}
+
+func BenchmarkRegistryGet(b *testing.B) {
+
+	r := NewRegistry[int](benchRegistrySize)
+	handles := make([]Handle, benchRegistrySize)
+	for i := 0; i < len(handles); i++ {
+		_, handles[i], _ = r.New()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.Get(handles[i%len(handles)])
+	}
+}
+
+func BenchmarkConcurrentRegistryGet(b *testing.B) {
+
+	cr := NewConcurrentRegistry[int](benchRegistrySize)
+	handles := make([]Handle, benchRegistrySize)
+	for i := 0; i < len(handles); i++ {
+		_, handles[i], _ = cr.New()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cr.Get(handles[i%len(handles)])
+	}
+}
+
+func BenchmarkConcurrentRegistryGetParallel(b *testing.B) {
+
+	cr := NewConcurrentRegistry[int](benchRegistrySize)
+	handles := make([]Handle, benchRegistrySize)
+	for i := 0; i < len(handles); i++ {
+		_, handles[i], _ = cr.New()
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cr.Get(handles[i%len(handles)])
+			i++
+		}
+	})
+}
+
+func TestConcurrentRegistryForEachFreeDeferred(t *testing.T) {
+
+	const itemCount = 1000
+
+	cr := NewConcurrentRegistry[int](64)
+	handles := make([]Handle, itemCount)
+	for i := 0; i < itemCount; i++ {
+
+		item, h, err := cr.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		*item = i
+		handles[i] = h
+	}
+
+	// A writer that keeps waiting for the write lock, which is what makes recursive read locks deadlock
+	stopWriter := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+
+		defer close(writerDone)
+		for {
+			select {
+			case <-stopWriter:
+				return
+			default:
+			}
+
+			_, h, err := cr.New()
+			if err != nil {
+				t.Errorf("Failed to create item. Err: %v", err)
+				return
+			}
+			cr.Free(h)
+		}
+	}()
+
+	forEachDone := make(chan struct{})
+	go func() {
+
+		defer close(forEachDone)
+		for i := 0; i < 20; i++ {
+
+			// Freeing using FreeDeferred is the only registry call allowed from within fn
+			cr.ForEach(func(item *int, handle Handle) {
+				if *item%2 == 0 {
+					cr.FreeDeferred(handle)
+				}
+			})
+		}
+	}()
+
+	select {
+	case <-forEachDone:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("ForEach deadlocked")
+	}
+
+	close(stopWriter)
+	<-writerDone
+
+	cr.FlushDeferred()
+
+	for i, h := range handles {
+
+		isAlive := cr.Get(h) != nil
+		if isAlive != (i%2 == 1) {
+			t.Fatalf("Expected item %d alive=%v after flushing, but got alive=%v", i, i%2 == 1, isAlive)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package registry
+
+import (
+	"sync/atomic"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/consts"
+)
+
+// DenseRegistry is a registry backed by a sparse set, and uses the same handle semantics as Registry.
+//
+// Items are always stored packed together in the Items array, which makes iteration a simple loop over a contiguous slice
+// regardless of how many items have been freed. New and Free are O(1), with Free moving the last item into the freed spot.
+//
+// Because items are moved around on Free and when the registry grows, pointers returned by the registry
+// are ONLY valid until the next call to New or Free. Handles should be stored instead of pointers.
+//
+// It is NOT safe to concurrently create or free items. However, it is SAFE to concurrently get items
+type DenseRegistry[T any] struct {
+
+	// Slots is indexed using the handle index. Each slot stores the generation and flags
+	// of its handle, but its index is the index of the item in Items
+	Slots []Handle
+
+	// Items and ItemHandles are packed arrays, where ItemHandles[i] is the handle of Items[i]
+	Items       []T
+	ItemHandles []Handle
+
+	// FreeSlots is a stack of slot indices that can be reused
+	FreeSlots []uint64
+
+	// RetiredSlotCount is the number of slots that reached the max generation and will never be used again
+	RetiredSlotCount uint
+
+	MaxSize       uint32
+	DisableGrowth bool
+}
+
+func (r *DenseRegistry[T]) New() (*T, Handle, error) {
+
+	var slotIndex uint64
+	if len(r.FreeSlots) > 0 {
+
+		slotIndex = r.FreeSlots[len(r.FreeSlots)-1]
+		r.FreeSlots = r.FreeSlots[:len(r.FreeSlots)-1]
+	} else {
+
+		slotIndex = uint64(len(r.Slots))
+
+		// Only check growth when we need more than the initially allocated slots
+		if slotIndex >= uint64(cap(r.Slots)) && r.DisableGrowth {
+			return nil, 0, ErrRegistryFull
+		}
+
+		if (r.MaxSize > 0 && slotIndex >= uint64(r.MaxSize)) || slotIndex > indexBitMask {
+			return nil, 0, ErrRegistryFull
+		}
+
+		r.Slots = append(r.Slots, 0)
+	}
+
+	denseIndex := uint64(len(r.Items))
+	newHandle := NewHandle(r.Slots[slotIndex].Generation()+1, slotIndex)
+	assert.T(newHandle != 0, "Entity handle must not be zero")
+
+	var newItem T
+	r.Items = append(r.Items, newItem)
+	r.ItemHandles = append(r.ItemHandles, newHandle)
+	r.Slots[slotIndex] = NewHandle(newHandle.Generation(), denseIndex)
+
+	return &r.Items[denseIndex], newHandle, nil
+}
+
+func (r *DenseRegistry[T]) Get(id Handle) *T {
+
+	if id.IsZero() {
+		return nil
+	}
+
+	slotIndex := id.Index()
+	assert.T(slotIndex < uint64(len(r.Slots)), "Failed to get entity because of invalid entity handle. Handle index is %d while registry only has %d slots. Handle: %+v", slotIndex, len(r.Slots), id)
+
+	slot := r.Slots[slotIndex]
+	if slot.Generation() != id.Generation() || !slot.HasFlag(HandleFlag_Alive) {
+		return nil
+	}
+
+	return &r.Items[slot.Index()]
+}
+
+// Free removes the item by moving the last item into its place, then adds its slot to the free slots
+func (r *DenseRegistry[T]) Free(id Handle) {
+
+	slotIndex := id.Index()
+	assert.T(slotIndex < uint64(len(r.Slots)), "Failed to free entity because of invalid entity handle. Handle index is %d while registry only has %d slots. Handle: %+v", slotIndex, len(r.Slots), id)
+
+	// Nothing to do if already free
+	slot := r.Slots[slotIndex]
+	if slot.Generation() != id.Generation() || !slot.HasFlag(HandleFlag_Alive) {
+		return
+	}
+
+	// Swap remove
+	denseIndex := slot.Index()
+	lastIndex := uint64(len(r.Items) - 1)
+	if denseIndex != lastIndex {
+
+		movedHandle := r.ItemHandles[lastIndex]
+		r.Items[denseIndex] = r.Items[lastIndex]
+		r.ItemHandles[denseIndex] = movedHandle
+		r.Slots[movedHandle.Index()] = NewHandle(movedHandle.Generation(), denseIndex)
+	}
+
+	// Zero the removed item so we don't keep anything it points to alive
+	var zero T
+	r.Items[lastIndex] = zero
+	r.Items = r.Items[:lastIndex]
+	r.ItemHandles = r.ItemHandles[:lastIndex]
+
+	// Same as Registry, slots that reach the max generation are never reused
+	freed, isRetired := freedHandle(id, 0)
+	r.Slots[slotIndex] = freed
+	if isRetired {
+
+		r.RetiredSlotCount++
+
+		if consts.Debug {
+			atomic.AddUint64(&debugRetiredSlotCount, 1)
+		}
+
+		return
+	}
+
+	r.FreeSlots = append(r.FreeSlots, slotIndex)
+}
+
+func (r *DenseRegistry[T]) ItemCount() uint {
+	return uint(len(r.Items))
+}
+
+func (r *DenseRegistry[T]) NewIterator() DenseIterator[T] {
+	return DenseIterator[T]{
+		registry:  r,
+		currIndex: len(r.Items),
+	}
+}
+
+func NewDenseRegistry[T any](size uint32) *DenseRegistry[T] {
+	return NewDenseRegistryWithOptions[T](&RegistryOptions{
+		InitialSize: size,
+		ChunkSize:   size,
+	})
+}
+
+// NewDenseRegistryWithOptions creates a dense registry. ChunkSize is ignored because a dense registry is not chunked
+func NewDenseRegistryWithOptions[T any](opts *RegistryOptions) *DenseRegistry[T] {
+
+	assert.T(opts.InitialSize > 0, "Registry size must be more than zero")
+	assert.T(opts.MaxSize == 0 || opts.MaxSize >= opts.InitialSize, "Registry max size must be zero or more than or equal to the initial size")
+	assert.T(uint64(opts.InitialSize)-1 <= indexBitMask, "Registry initial size of %d is more than the max index %d allowed by the handle layout", opts.InitialSize, indexBitMask)
+
+	atomic.StoreUint32(&handleLayoutInUse, 1)
+
+	return &DenseRegistry[T]{
+		Slots:         make([]Handle, 0, opts.InitialSize),
+		Items:         make([]T, 0, opts.InitialSize),
+		ItemHandles:   make([]Handle, 0, opts.InitialSize),
+		FreeSlots:     make([]uint64, 0),
+		MaxSize:       opts.MaxSize,
+		DisableGrowth: opts.DisableGrowth,
+	}
+}
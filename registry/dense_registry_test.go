@@ -0,0 +1,205 @@
+package registry
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestDenseIteratorFreeWhileIterating(t *testing.T) {
+
+	r := NewDenseRegistry[int](16)
+	for i := 0; i < 100; i++ {
+		item, _, _ := r.New()
+		*item = i
+	}
+
+	seen := make(map[int]struct{}, 100)
+	it := r.NewIterator()
+	for item, handle := it.Next(); item != nil; item, handle = it.Next() {
+
+		if _, ok := seen[*item]; ok {
+			t.Fatalf("Item %d returned twice", *item)
+		}
+		seen[*item] = struct{}{}
+
+		if *item%2 == 0 {
+			r.Free(handle)
+		}
+	}
+
+	if len(seen) != 100 {
+		t.Fatalf("Expected to see 100 items, but saw %d", len(seen))
+	}
+
+	if r.ItemCount() != 50 {
+		t.Fatalf("Expected 50 items after freeing the even ones, but got %d", r.ItemCount())
+	}
+
+	it = r.NewIterator()
+	for item, _ := it.Next(); item != nil; item, _ = it.Next() {
+		if *item%2 == 0 {
+			t.Fatalf("Freed item %d is still in the registry", *item)
+		}
+	}
+}
+
+const (
+	benchOccupancySlotCount = 10_000
+)
+
+var (
+	benchOccupancies = []int{10, 50, 90}
+)
+
+// occupancyHandles creates slotCount items using newFn then frees random items using freeFn until
+// only occupancyPercent of them remain. The remaining handles are returned
+func occupancyHandles(occupancyPercent int, newFn func() Handle, freeFn func(Handle)) []Handle {
+
+	handles := make([]Handle, benchOccupancySlotCount)
+	for i := 0; i < len(handles); i++ {
+		handles[i] = newFn()
+	}
+
+	rng := rand.New(rand.NewSource(42))
+	rng.Shuffle(len(handles), func(i, j int) {
+		handles[i], handles[j] = handles[j], handles[i]
+	})
+
+	keepCount := benchOccupancySlotCount * occupancyPercent / 100
+	for _, h := range handles[keepCount:] {
+		freeFn(h)
+	}
+
+	return handles[:keepCount]
+}
+
+func newOccupiedRegistry(occupancyPercent int) (*Registry[int], []Handle) {
+
+	r := NewRegistry[int](benchOccupancySlotCount)
+	handles := occupancyHandles(
+		occupancyPercent,
+		func() Handle {
+			item, h, _ := r.New()
+			*item = 1
+			return h
+		},
+		r.Free,
+	)
+
+	return r, handles
+}
+
+func newOccupiedDenseRegistry(occupancyPercent int) (*DenseRegistry[int], []Handle) {
+
+	r := NewDenseRegistry[int](benchOccupancySlotCount)
+	handles := occupancyHandles(
+		occupancyPercent,
+		func() Handle {
+			item, h, _ := r.New()
+			*item = 1
+			return h
+		},
+		r.Free,
+	)
+
+	return r, handles
+}
+
+func BenchmarkIterate(b *testing.B) {
+
+	for _, occupancy := range benchOccupancies {
+
+		b.Run(fmt.Sprintf("Registry/%d%%", occupancy), func(b *testing.B) {
+
+			r, _ := newOccupiedRegistry(occupancy)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+
+				sum := 0
+				it := r.NewIterator()
+				for item, _ := it.Next(); !it.IsDone(); item, _ = it.Next() {
+					sum += *item
+				}
+
+				if sum != int(r.ItemCount) {
+					b.Fatalf("Expected sum of %d, but got %d", r.ItemCount, sum)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("DenseRegistry/%d%%", occupancy), func(b *testing.B) {
+
+			r, _ := newOccupiedDenseRegistry(occupancy)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+
+				sum := 0
+				it := r.NewIterator()
+				for item, _ := it.Next(); item != nil; item, _ = it.Next() {
+					sum += *item
+				}
+
+				if sum != int(r.ItemCount()) {
+					b.Fatalf("Expected sum of %d, but got %d", r.ItemCount(), sum)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNewFree(b *testing.B) {
+
+	for _, occupancy := range benchOccupancies {
+
+		b.Run(fmt.Sprintf("Registry/%d%%", occupancy), func(b *testing.B) {
+
+			r, _ := newOccupiedRegistry(occupancy)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, h, _ := r.New()
+				r.Free(h)
+			}
+		})
+
+		b.Run(fmt.Sprintf("DenseRegistry/%d%%", occupancy), func(b *testing.B) {
+
+			r, _ := newOccupiedDenseRegistry(occupancy)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, h, _ := r.New()
+				r.Free(h)
+			}
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+
+	for _, occupancy := range benchOccupancies {
+
+		b.Run(fmt.Sprintf("Registry/%d%%", occupancy), func(b *testing.B) {
+
+			r, handles := newOccupiedRegistry(occupancy)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.Get(handles[i%len(handles)])
+			}
+		})
+
+		b.Run(fmt.Sprintf("DenseRegistry/%d%%", occupancy), func(b *testing.B) {
+
+			r, handles := newOccupiedDenseRegistry(occupancy)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.Get(handles[i%len(handles)])
+			}
+		})
+	}
+}
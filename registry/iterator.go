@@ -12,6 +12,8 @@ package registry
 //
 // To summarize: The iterator will *never* return more items than were alive at the time of its creation, and will *never* return freed items
 //
+// To avoid all of the above, use Registry.FreeDeferred while iterating and call Registry.FlushDeferred once done.
+//
 // Example usage:
 //
 //	for item, handle := it.Next(); !it.IsDone(); item, handle = it.Next() {
@@ -45,7 +47,7 @@ func (it *Iterator[T]) Next() (*T, Handle) {
 			continue
 		}
 
-		item := &it.registry.Items[it.currIndex]
+		item := it.registry.itemAt(uint64(it.currIndex))
 		it.currIndex++
 		it.remainingItems--
 		return item, handle
@@ -71,3 +73,76 @@ func (it *Iterator[T]) IsDone() bool {
 	// 2. Negative index means Next() has detected we reached the end and that its safe to report being done
 	return it.currIndex <= 0
 }
+
+// RangeIterator goes through the slots [start, end) of the registry it was created from
+// and returns the alive items in that range.
+//
+// Multiple range iterators over non-overlapping ranges can be used concurrently as long as
+// the registry isn't modified while they are in use.
+//
+// Example usage:
+//
+//	for item, handle := it.Next(); item != nil; item, handle = it.Next() {
+//		// Do stuff
+//	}
+type RangeIterator[T any] struct {
+	registry  *Registry[T]
+	currIndex uint64
+	endIndex  uint64
+}
+
+// Next returns the next alive item in the range, or nil when there are no more items
+func (it *RangeIterator[T]) Next() (*T, Handle) {
+
+	// Clamp in case the registry changed since we were created
+	end := it.endIndex
+	if end > uint64(len(it.registry.Handles)) {
+		end = uint64(len(it.registry.Handles))
+	}
+
+	for ; it.currIndex < end; it.currIndex++ {
+
+		handle := it.registry.Handles[it.currIndex]
+		if !handle.HasFlag(HandleFlag_Alive) {
+			continue
+		}
+
+		item := it.registry.itemAt(it.currIndex)
+		it.currIndex++
+		return item, handle
+	}
+
+	return nil, 0
+}
+
+// DenseIterator goes through the items of a DenseRegistry, from the last item to the first.
+//
+// Going backwards makes it safe to Free the item returned by the last call to Next, because Free only moves the last item
+// (which was already returned) into the freed spot. Items created while iterating are not returned.
+//
+// Example usage:
+//
+//	for item, handle := it.Next(); item != nil; item, handle = it.Next() {
+//		// Do stuff
+//	}
+type DenseIterator[T any] struct {
+	registry  *DenseRegistry[T]
+	currIndex int
+}
+
+// Next returns the next item, or nil when there are no more items
+func (it *DenseIterator[T]) Next() (*T, Handle) {
+
+	it.currIndex--
+
+	// Clamp in case multiple items were freed since the last call
+	if it.currIndex >= len(it.registry.Items) {
+		it.currIndex = len(it.registry.Items) - 1
+	}
+
+	if it.currIndex < 0 {
+		return nil, 0
+	}
+
+	return &it.registry.Items[it.currIndex], it.registry.ItemHandles[it.currIndex]
+}
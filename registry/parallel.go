@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/bloeys/nmage/assert"
+)
+
+// NewRangeIterator returns an iterator over the slots [start, end). End is clamped to the number of slots in the registry
+func (r *Registry[T]) NewRangeIterator(start, end uint64) RangeIterator[T] {
+
+	assert.T(start <= end, "Range iterator start must be less than or equal to end, but got start=%d and end=%d", start, end)
+
+	if end > uint64(len(r.Handles)) {
+		end = uint64(len(r.Handles))
+	}
+
+	return RangeIterator[T]{
+		registry:  r,
+		currIndex: start,
+		endIndex:  end,
+	}
+}
+
+// SplitRanges splits the slots of the registry into at most 'count' contiguous ranges of roughly equal size and returns
+// an iterator for each range. Together the iterators visit each alive item exactly once. A count less than one is treated as one
+func (r *Registry[T]) SplitRanges(count int) []RangeIterator[T] {
+
+	if count < 1 {
+		count = 1
+	}
+
+	slotCount := uint64(len(r.Handles))
+	if uint64(count) > slotCount {
+		count = int(slotCount)
+	}
+
+	rangeSize := (slotCount + uint64(count) - 1) / uint64(count)
+	iters := make([]RangeIterator[T], 0, count)
+	for start := uint64(0); start < slotCount; start += rangeSize {
+		iters = append(iters, r.NewRangeIterator(start, start+rangeSize))
+	}
+
+	return iters
+}
+
+// ForEachParallel splits the registry slots over 'workers' goroutines and calls fn on every alive item exactly once.
+// It only returns after all workers are done. If workers is less than one then runtime.GOMAXPROCS(0) is used.
+//
+// fn is called concurrently and so must be safe to call from multiple goroutines.
+// The registry must NOT be modified (i.e. no New or Free) until ForEachParallel returns
+func (r *Registry[T]) ForEachParallel(workers int, fn func(item *T, handle Handle)) {
+
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	if r.ItemCount == 0 {
+		return
+	}
+
+	iters := r.SplitRanges(workers)
+
+	// No need to pay for goroutines if we only have one range
+	if len(iters) == 1 {
+		for item, handle := iters[0].Next(); item != nil; item, handle = iters[0].Next() {
+			fn(item, handle)
+		}
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(iters))
+	for i := 0; i < len(iters); i++ {
+
+		go func(it *RangeIterator[T]) {
+
+			defer wg.Done()
+			for item, handle := it.Next(); item != nil; item, handle = it.Next() {
+				fn(item, handle)
+			}
+		}(&iters[i])
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newSparseRegistry creates a registry spanning several chunks where only some slots are alive
+func newSparseRegistry(t *testing.T) (*Registry[int], []Handle) {
+
+	r := NewRegistry[int](16)
+	all := make([]Handle, 0, 100)
+	for i := 0; i < 100; i++ {
+
+		item, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		*item = i
+		all = append(all, h)
+	}
+
+	alive := make([]Handle, 0, len(all))
+	for i, h := range all {
+
+		// Free runs of slots, including whole ranges, so that some workers see nothing alive
+		if i%3 == 0 || (i >= 40 && i < 60) {
+			r.Free(h)
+			continue
+		}
+
+		alive = append(alive, h)
+	}
+
+	return r, alive
+}
+
+func checkVisitCounts(t *testing.T, name string, r *Registry[int], alive []Handle, visits []int32) {
+
+	t.Helper()
+
+	isAlive := make(map[uint64]bool, len(alive))
+	for _, h := range alive {
+		isAlive[h.Index()] = true
+	}
+
+	for i := range visits {
+
+		expected := int32(0)
+		if isAlive[uint64(i)] {
+			expected = 1
+		}
+
+		if got := atomic.LoadInt32(&visits[i]); got != expected {
+			t.Fatalf("%s: expected slot %d to be visited %d times, but it was visited %d times", name, i, expected, got)
+		}
+	}
+}
+
+func TestSplitRanges(t *testing.T) {
+
+	r, alive := newSparseRegistry(t)
+	slotCount := len(r.Handles)
+
+	for _, count := range []int{-5, 0, 1, 2, 3, 7, slotCount, slotCount + 1, 10 * slotCount} {
+
+		iters := r.SplitRanges(count)
+
+		maxIters := count
+		if maxIters < 1 {
+			maxIters = 1
+		}
+
+		if maxIters > slotCount {
+			maxIters = slotCount
+		}
+
+		if len(iters) == 0 || len(iters) > maxIters {
+			t.Fatalf("count=%d: expected between 1 and %d ranges, but got %d", count, maxIters, len(iters))
+		}
+
+		visits := make([]int32, slotCount)
+		for i := range iters {
+			for item, h := iters[i].Next(); item != nil; item, h = iters[i].Next() {
+
+				if *item != int(h.Index()) {
+					t.Fatalf("count=%d: item %d returned with handle of slot %d", count, *item, h.Index())
+				}
+
+				visits[h.Index()]++
+			}
+		}
+
+		checkVisitCounts(t, "SplitRanges", r, alive, visits)
+	}
+}
+
+func TestForEachParallel(t *testing.T) {
+
+	r, alive := newSparseRegistry(t)
+	slotCount := len(r.Handles)
+
+	for _, workers := range []int{-1, 0, 1, 2, 3, 8, slotCount + 1, 10 * slotCount} {
+
+		visits := make([]int32, slotCount)
+		var running, finished int32
+
+		r.ForEachParallel(workers, func(item *int, handle Handle) {
+
+			atomic.AddInt32(&running, 1)
+
+			// Make workers overlap so that returning early would be noticed
+			time.Sleep(10 * time.Microsecond)
+			atomic.AddInt32(&visits[handle.Index()], 1)
+
+			atomic.AddInt32(&running, -1)
+			atomic.AddInt32(&finished, 1)
+		})
+
+		// Once ForEachParallel returns every call must be done
+		if atomic.LoadInt32(&running) != 0 || atomic.LoadInt32(&finished) != int32(len(alive)) {
+			t.Fatalf("workers=%d: returned with %d calls running and %d of %d done", workers, atomic.LoadInt32(&running), atomic.LoadInt32(&finished), len(alive))
+		}
+
+		checkVisitCounts(t, "ForEachParallel", r, alive, visits)
+	}
+
+	// Empty registries must not call fn at all
+	empty := NewRegistry[int](16)
+	empty.ForEachParallel(4, func(item *int, handle Handle) {
+		t.Fatalf("fn called on an empty registry")
+	})
+}
@@ -1,26 +1,65 @@
 package registry
 
 import (
+	"errors"
 	"math"
+	"sync/atomic"
 
 	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/consts"
 )
 
+var (
+	ErrRegistryFull = errors.New("registry is full and can not grow any further")
+
+	// debugRetiredSlotCount is the number of slots retired across all registries. Only tracked in debug builds
+	debugRetiredSlotCount uint64
+)
+
+// DebugRetiredSlotCount returns the number of slots retired across all registries.
+// This is only tracked in debug builds and always returns zero in release builds
+func DebugRetiredSlotCount() uint64 {
+	return atomic.LoadUint64(&debugRetiredSlotCount)
+}
+
 type freeListitem struct {
 	ItemIndex uint64
 	nextFree  *freeListitem
 }
 
+type RegistryOptions struct {
+	// InitialSize is the number of slots allocated on creation. It is rounded up to a multiple of ChunkSize
+	InitialSize uint32
+
+	// ChunkSize is the number of items in each allocated chunk of items.
+	// When the registry is full a new chunk of this size is allocated.
+	ChunkSize uint32
+
+	// MaxSize is the maximum number of slots the registry can grow to. Zero means no limit
+	MaxSize uint32
+
+	// DisableGrowth makes the registry stay at its initial size, and New returns ErrRegistryFull when the registry is full
+	DisableGrowth bool
+}
+
 // Registry is a storage data structure that can efficiently create/get/free items using generational indices.
 // Each item stored in the registry is associated with a 'handle' object that is used to get and free objects
 //
-// The registry 'owns' all items it stores and returns pointers to items in its array. All items are allocated upfront.
+// The registry 'owns' all items it stores and returns pointers to items in its chunks. Items are allocated in fixed size chunks
+// and chunks are never moved or freed, so pointers returned by the registry stay valid even after the registry grows.
 //
 // It is NOT safe to concurrently create or free items. However, it is SAFE to concurrently get items
 type Registry[T any] struct {
-	ItemCount uint
-	Handles   []Handle
-	Items     []T
+	ItemCount  uint
+	Handles    []Handle
+	ItemChunks [][]T
+
+	// RetiredSlotCount is the number of slots that reached the max generation and will never be used again
+	RetiredSlotCount uint
+
+	ChunkSize     uint32
+	MaxSize       uint32
+	DisableGrowth bool
 
 	FreeList     *freeListitem
 	FreeListSize uint32
@@ -28,51 +67,107 @@ type Registry[T any] struct {
 	// The number of slots required to be in the free list before the free list
 	// is used for creating new entries
 	FreeListUsageThreshold uint32
-}
 
-func (r *Registry[T]) New() (*T, Handle) {
+	// OnCreateCallbacks are called in order after an item is created.
+	// OnFreeCallbacks are called in order before an item is freed, while the item is still alive.
+	// Free callbacks must NOT free the item being freed, but can free other items
+	OnCreateCallbacks []func(item *T, handle Handle)
+	OnFreeCallbacks   []func(item *T, handle Handle)
 
-	assert.T(r.ItemCount < uint(len(r.Handles)), "Can not add more entities to registry because it is full")
+	// DeferredFrees are handles queued by FreeDeferred that will be freed on the next FlushDeferred
+	DeferredFrees []Handle
+}
+
+func (r *Registry[T]) New() (*T, Handle, error) {
 
 	var index uint64 = math.MaxUint64
 
 	// Find index to use for the new item
-	if r.FreeList != nil && r.FreeListSize > r.FreeListUsageThreshold {
+	if r.ItemCount+r.RetiredSlotCount >= uint(len(r.Handles)) {
 
-		index = r.FreeList.ItemIndex
-
-		r.FreeList = r.FreeList.nextFree
-		r.FreeListSize--
+		// When full we grow and use the first slot of the new chunk
+		index = uint64(len(r.Handles))
+		err := r.grow()
+		if err != nil {
+			return nil, 0, err
+		}
 	} else {
 
-		for i := 0; i < len(r.Handles); i++ {
+		// Slots found through the linear search are not removed from the free list, so free list
+		// entries might point to slots that are alive again or that got retired since, in which case we skip them
+		for r.FreeList != nil && r.FreeListSize > r.FreeListUsageThreshold {
+
+			freeIndex := r.FreeList.ItemIndex
+
+			r.FreeList = r.FreeList.nextFree
+			r.FreeListSize--
+
+			freeHandle := r.Handles[freeIndex]
+			if !freeHandle.HasFlag(HandleFlag_Alive) && !freeHandle.HasFlag(HandleFlag_Retired) {
+				index = freeIndex
+				break
+			}
+		}
+
+		for i := 0; index == math.MaxUint64 && i < len(r.Handles); i++ {
 
 			handle := r.Handles[i]
 
-			if handle.HasFlag(HandleFlag_Alive) {
+			if handle.HasFlag(HandleFlag_Alive) || handle.HasFlag(HandleFlag_Retired) {
 				continue
 			}
 
 			index = uint64(i)
-			break
 		}
 	}
 
 	if index == math.MaxUint64 {
-		panic("failed to create new entity because we did not find a free spot in the registry. Why did the item count assert not go off?")
+		panic("failed to create new entity because we did not find a free spot in the registry. Why did the item count check not catch this?")
 	}
 
 	var newItem T
-	newHandle := NewHandle(r.Handles[index].Generation()+1, HandleFlag_Alive, index)
+	newHandle := NewHandle(r.Handles[index].Generation()+1, index)
 	assert.T(newHandle != 0, "Entity handle must not be zero")
 
+	item := r.itemAt(index)
+
 	r.ItemCount++
 	r.Handles[index] = newHandle
-	r.Items[index] = newItem
+	*item = newItem
+
+	for i := 0; i < len(r.OnCreateCallbacks); i++ {
+		r.OnCreateCallbacks[i](item, newHandle)
+	}
+
+	// It is very important we return directly from the chunks, because if we return
+	// a pointer to newItem, and T is a value not a pointer, then newItem and what's stored in the chunks will be different
+	return item, newHandle, nil
+}
+
+// grow adds a new chunk to the registry, or returns ErrRegistryFull if that's not allowed
+func (r *Registry[T]) grow() error {
+
+	if r.DisableGrowth {
+		return ErrRegistryFull
+	}
+
+	newSize := uint64(len(r.Handles)) + uint64(r.ChunkSize)
+	if r.MaxSize > 0 && newSize > uint64(r.MaxSize) {
+		return ErrRegistryFull
+	}
 
-	// It is very important we return directly from the items array, because if we return
-	// a pointer to newItem, and T is a value not a pointer, then newItem and what's stored in items will be different
-	return &r.Items[index], newHandle
+	if newSize-1 > indexBitMask {
+		return ErrRegistryFull
+	}
+
+	r.ItemChunks = append(r.ItemChunks, make([]T, r.ChunkSize))
+	r.Handles = append(r.Handles, make([]Handle, r.ChunkSize)...)
+	return nil
+}
+
+// itemAt returns a pointer to the item stored in the given slot, regardless of whether its alive or not
+func (r *Registry[T]) itemAt(index uint64) *T {
+	return &r.ItemChunks[index/uint64(r.ChunkSize)][index%uint64(r.ChunkSize)]
 }
 
 func (r *Registry[T]) Get(id Handle) *T {
@@ -82,22 +177,21 @@ func (r *Registry[T]) Get(id Handle) *T {
 	}
 
 	index := id.Index()
-	assert.T(index < uint64(len(r.Handles)), "Failed to get entity because of invalid entity handle. Handle index is %d while registry only has %d slots. Handle: %+v", index, r.ItemCount, id)
+	assert.T(index < uint64(len(r.Handles)), "Failed to get entity because of invalid entity handle. Handle index is %d while registry only has %d slots. Handle: %+v", index, len(r.Handles), id)
 
 	handle := r.Handles[index]
 	if handle.Generation() != id.Generation() || !handle.HasFlag(HandleFlag_Alive) {
 		return nil
 	}
 
-	item := &r.Items[index]
-	return item
+	return r.itemAt(index)
 }
 
 // Free resets the entity flags then adds this entity to the free list
 func (r *Registry[T]) Free(id Handle) {
 
 	index := id.Index()
-	assert.T(index < uint64(len(r.Handles)), "Failed to free entity because of invalid entity handle. Handle index is %d while registry only has %d slots. Handle: %+v", index, r.ItemCount, id)
+	assert.T(index < uint64(len(r.Handles)), "Failed to free entity because of invalid entity handle. Handle index is %d while registry only has %d slots. Handle: %+v", index, len(r.Handles), id)
 
 	// Nothing to do if already free
 	handle := r.Handles[index]
@@ -105,9 +199,30 @@ func (r *Registry[T]) Free(id Handle) {
 		return
 	}
 
-	// Generation is incremented on aquire, so here we just reset flags
+	if len(r.OnFreeCallbacks) > 0 {
+
+		item := r.itemAt(index)
+		for i := 0; i < len(r.OnFreeCallbacks); i++ {
+			r.OnFreeCallbacks[i](item, handle)
+		}
+	}
+
 	r.ItemCount--
-	r.Handles[index] = NewHandle(id.Generation(), HandleFlag_None, index)
+
+	// Once a slot reaches max generation it is retired and never used again, because reusing it would
+	// wrap the generation around and old handles to this slot would start returning new items
+	freed, isRetired := freedHandle(id, index)
+	r.Handles[index] = freed
+	if isRetired {
+
+		r.RetiredSlotCount++
+
+		if consts.Debug {
+			atomic.AddUint64(&debugRetiredSlotCount, 1)
+		}
+
+		return
+	}
 
 	// Add to free list
 	r.FreeList = &freeListitem{
@@ -117,6 +232,30 @@ func (r *Registry[T]) Free(id Handle) {
 	r.FreeListSize++
 }
 
+// FreeDeferred queues the handle to be freed on the next call to FlushDeferred.
+// The item stays alive and can be retrieved using Get until then.
+//
+// This makes it safe to free items while iterating over the registry
+func (r *Registry[T]) FreeDeferred(id Handle) {
+	r.DeferredFrees = append(r.DeferredFrees, id)
+}
+
+// FlushDeferred frees all handles queued using FreeDeferred, including ones queued by the free callbacks while flushing
+func (r *Registry[T]) FlushDeferred() {
+
+	// Not using range because callbacks might add more handles while we loop
+	for i := 0; i < len(r.DeferredFrees); i++ {
+		r.Free(r.DeferredFrees[i])
+	}
+
+	r.DeferredFrees = r.DeferredFrees[:0]
+}
+
+// Cap returns the number of slots currently allocated in the registry
+func (r *Registry[T]) Cap() uint {
+	return uint(len(r.Handles))
+}
+
 func (r *Registry[T]) NewIterator() Iterator[T] {
 	return Iterator[T]{
 		registry:       r,
@@ -125,11 +264,38 @@ func (r *Registry[T]) NewIterator() Iterator[T] {
 	}
 }
 
+// NewRegistry creates a registry with 'size' slots that grows by 'size' slots every time it gets full
 func NewRegistry[T any](size uint32) *Registry[T] {
-	assert.T(size > 0, "Registry size must be more than zero")
-	return &Registry[T]{
-		Handles:                make([]Handle, size),
-		Items:                  make([]T, size),
+	return NewRegistryWithOptions[T](&RegistryOptions{
+		InitialSize: size,
+		ChunkSize:   size,
+	})
+}
+
+func NewRegistryWithOptions[T any](opts *RegistryOptions) *Registry[T] {
+
+	assert.T(opts.InitialSize > 0, "Registry size must be more than zero")
+	assert.T(opts.ChunkSize > 0, "Registry chunk size must be more than zero")
+	assert.T(opts.MaxSize == 0 || opts.MaxSize >= opts.InitialSize, "Registry max size must be zero or more than or equal to the initial size")
+	assert.T(opts.MaxSize == 0 || opts.MaxSize%opts.ChunkSize == 0, "Registry max size must be zero or a multiple of the chunk size")
+
+	chunkCount := (opts.InitialSize + opts.ChunkSize - 1) / opts.ChunkSize
+	assert.T(uint64(chunkCount)*uint64(opts.ChunkSize)-1 <= indexBitMask, "Registry initial size of %d is more than the max index %d allowed by the handle layout", uint64(chunkCount)*uint64(opts.ChunkSize), indexBitMask)
+
+	atomic.StoreUint32(&handleLayoutInUse, 1)
+	r := &Registry[T]{
+		Handles:                make([]Handle, 0, chunkCount*opts.ChunkSize),
+		ItemChunks:             make([][]T, 0, chunkCount),
+		ChunkSize:              opts.ChunkSize,
+		MaxSize:                opts.MaxSize,
+		DisableGrowth:          opts.DisableGrowth,
 		FreeListUsageThreshold: 30,
 	}
+
+	for i := uint32(0); i < chunkCount; i++ {
+		r.ItemChunks = append(r.ItemChunks, make([]T, opts.ChunkSize))
+		r.Handles = append(r.Handles, make([]Handle, opts.ChunkSize)...)
+	}
+
+	return r
 }
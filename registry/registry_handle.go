@@ -1,19 +1,96 @@
 package registry
 
+import (
+	"sync/atomic"
+
+	"github.com/bloeys/nmage/assert"
+)
+
 type HandleFlag byte
 
 const (
 	HandleFlag_None  HandleFlag = 0
 	HandleFlag_Alive HandleFlag = 1 << (iota - 1)
+
+	// HandleFlag_Retired is set on slots whose generation reached its max value.
+	// Retired slots are never reused so that old handles never alias new items
+	HandleFlag_Retired
 )
 
-const (
-	GenerationShiftBits = 64 - 8
-	FlagsShiftBits      = 64 - 16
-	IndexBitMask        = 0x00_00_FFFF_FFFF_FFFF
+// HandleLayout describes how many bits of a handle are used for the generation and the index, and the two must add up to at most 64.
+//
+// Flags take no bits of their own and are packed into the generation instead: odd generations are alive, even generations are free,
+// and a generation with all bits set marks a retired slot. This means a slot can be used 2^(GenerationBits-1)-1 times before being retired.
+//
+// The generation is stored in the highest bits and the index is stored in the lowest bits
+type HandleLayout struct {
+	GenerationBits uint8
+	IndexBits      uint8
+}
+
+var (
+	// DefaultHandleLayout allows each slot to be used ~2 billion times before being retired, and allows ~4 billion slots per registry
+	DefaultHandleLayout = HandleLayout{
+		GenerationBits: 32,
+		IndexBits:      32,
+	}
+
+	handleLayout = DefaultHandleLayout
+
+	// Set to 1 once a registry is created. Accessed atomically because registries can be created from any goroutine
+	handleLayoutInUse uint32
+
+	generationShiftBits uint64
+	generationBitMask   uint64
+	indexBitMask        uint64
+
+	// maxGeneration is the highest generation of an alive handle, and retiredGeneration marks retired slots
+	maxGeneration     uint32
+	retiredGeneration uint32
 )
 
-// Byte 1: Generation; Byte 2: Flags; Bytes 3-8: Index
+func init() {
+	applyHandleLayout(DefaultHandleLayout)
+}
+
+// SetHandleLayout changes the bit layout of all handles. It must be called before any registry is created
+func SetHandleLayout(hl HandleLayout) {
+
+	assert.T(atomic.LoadUint32(&handleLayoutInUse) == 0, "Handle layout can not be changed after a registry has been created")
+	assert.T(hl.GenerationBits >= 2 && hl.GenerationBits <= 32, "Handle generation bits must be in the range [2, 32], but got %d", hl.GenerationBits)
+	assert.T(hl.IndexBits > 0, "Handle index bits must be more than zero")
+	assert.T(uint(hl.GenerationBits)+uint(hl.IndexBits) <= 64, "Handle generation bits plus index bits must be at most 64, but got %d", uint(hl.GenerationBits)+uint(hl.IndexBits))
+
+	applyHandleLayout(hl)
+}
+
+func GetHandleLayout() HandleLayout {
+	return handleLayout
+}
+
+// MaxGeneration returns the highest generation an alive handle can have using the current handle layout.
+// A slot is retired when a handle with this generation is freed
+func MaxGeneration() uint32 {
+	return maxGeneration
+}
+
+// MaxIndex returns the highest index a handle can have using the current handle layout
+func MaxIndex() uint64 {
+	return indexBitMask
+}
+
+func applyHandleLayout(hl HandleLayout) {
+
+	handleLayout = hl
+
+	generationShiftBits = 64 - uint64(hl.GenerationBits)
+	generationBitMask = 1<<hl.GenerationBits - 1
+	indexBitMask = 1<<hl.IndexBits - 1
+	retiredGeneration = uint32(generationBitMask)
+	maxGeneration = retiredGeneration - 2
+}
+
+// Handle stores a generation and an index. See HandleLayout for how bits are used
 type Handle uint64
 
 // IsZero reports whether the handle is in its default 'zero' state.
@@ -26,18 +103,44 @@ func (h Handle) HasFlag(ef HandleFlag) bool {
 	return h.Flags()&ef > 0
 }
 
-func (h Handle) Generation() byte {
-	return byte(h >> GenerationShiftBits)
+func (h Handle) Generation() uint32 {
+	return uint32((uint64(h) >> generationShiftBits) & generationBitMask)
 }
 
+// Flags are derived from the generation. See HandleLayout
 func (h Handle) Flags() HandleFlag {
-	return HandleFlag(h >> FlagsShiftBits)
+
+	gen := h.Generation()
+	if gen == retiredGeneration {
+		return HandleFlag_Retired
+	}
+
+	if gen&1 == 1 {
+		return HandleFlag_Alive
+	}
+
+	return HandleFlag_None
 }
 
 func (h Handle) Index() uint64 {
-	return uint64(h & IndexBitMask)
+	return uint64(h) & indexBitMask
 }
 
-func NewHandle(generation byte, flags HandleFlag, index uint64) Handle {
-	return Handle(index | (uint64(generation) << GenerationShiftBits) | (uint64(flags) << FlagsShiftBits))
+func NewHandle(generation uint32, index uint64) Handle {
+
+	assert.T(uint64(generation) <= generationBitMask, "Handle generation %d is more than max generation %d", generation, generationBitMask)
+	assert.T(index <= indexBitMask, "Handle index %d is more than max index %d", index, indexBitMask)
+
+	return Handle(index | (uint64(generation) << generationShiftBits))
+}
+
+// freedHandle returns the handle a slot should store once the alive handle id is freed, and whether the slot got retired.
+// Alive generations are odd, so freeing moves to the next even generation, unless that would make the next alive generation pass the max
+func freedHandle(id Handle, index uint64) (Handle, bool) {
+
+	if id.Generation() >= maxGeneration {
+		return NewHandle(retiredGeneration, index), true
+	}
+
+	return NewHandle(id.Generation()+1, index), false
 }
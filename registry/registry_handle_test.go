@@ -0,0 +1,263 @@
+package registry
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bloeys/nmage/consts"
+)
+
+// useHandleLayout switches the handle layout for the duration of the test, even though registries were already created by other tests
+func useHandleLayout(t *testing.T, hl HandleLayout) {
+
+	atomic.StoreUint32(&handleLayoutInUse, 0)
+	SetHandleLayout(hl)
+
+	t.Cleanup(func() {
+		atomic.StoreUint32(&handleLayoutInUse, 0)
+		SetHandleLayout(DefaultHandleLayout)
+	})
+}
+
+func TestHandleLayout32x32(t *testing.T) {
+
+	useHandleLayout(t, HandleLayout{GenerationBits: 32, IndexBits: 32})
+
+	h := NewHandle(MaxGeneration(), MaxIndex())
+	if h.Generation() != MaxGeneration() || h.Index() != MaxIndex() {
+		t.Fatalf("Expected generation %d and index %d, but got %d and %d", MaxGeneration(), MaxIndex(), h.Generation(), h.Index())
+	}
+
+	if !h.HasFlag(HandleFlag_Alive) || h.HasFlag(HandleFlag_Retired) {
+		t.Fatalf("Expected a handle with max generation to be alive and not retired, but got flags %d", h.Flags())
+	}
+
+	freed, isRetired := freedHandle(h, h.Index())
+	if !isRetired || !freed.HasFlag(HandleFlag_Retired) || freed.HasFlag(HandleFlag_Alive) {
+		t.Fatalf("Expected freeing a handle with max generation to retire it, but got flags %d", freed.Flags())
+	}
+}
+
+func TestRegistrySlotRetirement(t *testing.T) {
+
+	useHandleLayout(t, HandleLayout{GenerationBits: 4, IndexBits: 8})
+
+	r := NewRegistryWithOptions[int](&RegistryOptions{
+		InitialSize:   1,
+		ChunkSize:     1,
+		DisableGrowth: true,
+	})
+
+	debugRetiredBefore := DebugRetiredSlotCount()
+
+	// Alive generations are odd, so a slot can be used 2^(GenerationBits-1)-1 times
+	expectedUses := 1<<(4-1) - 1
+	staleHandles := make([]Handle, 0, expectedUses)
+	for i := 0; i < expectedUses; i++ {
+
+		item, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item on use %d. Err: %v", i, err)
+		}
+		*item = i
+
+		for _, stale := range staleHandles {
+			if r.Get(stale) != nil {
+				t.Fatalf("Stale handle %v resolved to an item on use %d", stale, i)
+			}
+		}
+
+		if i == expectedUses-1 && h.Generation() != MaxGeneration() {
+			t.Fatalf("Expected the last use of the slot to have generation %d, but got %d", MaxGeneration(), h.Generation())
+		}
+
+		if r.RetiredSlotCount != 0 {
+			t.Fatalf("Slot retired too early on use %d", i)
+		}
+
+		r.Free(h)
+		staleHandles = append(staleHandles, h)
+	}
+
+	if r.RetiredSlotCount != 1 {
+		t.Fatalf("Expected 1 retired slot, but got %d", r.RetiredSlotCount)
+	}
+
+	if consts.Debug && DebugRetiredSlotCount() != debugRetiredBefore+1 {
+		t.Fatalf("Expected debug retired slot count to increase by 1, but went from %d to %d", debugRetiredBefore, DebugRetiredSlotCount())
+	}
+
+	if _, _, err := r.New(); !errors.Is(err, ErrRegistryFull) {
+		t.Fatalf("Expected ErrRegistryFull since the only slot is retired, but got %v", err)
+	}
+
+	for _, stale := range staleHandles {
+		if r.Get(stale) != nil {
+			t.Fatalf("Stale handle %v resolved to an item after the slot was retired", stale)
+		}
+	}
+}
+
+func TestRegistryStaleHandlesNeverResolve(t *testing.T) {
+
+	useHandleLayout(t, HandleLayout{GenerationBits: 5, IndexBits: 8})
+
+	const slotCount = 4
+	r := NewRegistryWithOptions[int](&RegistryOptions{
+		InitialSize:   slotCount,
+		ChunkSize:     slotCount,
+		DisableGrowth: true,
+	})
+
+	alive := make([]Handle, 0, slotCount)
+	stale := make([]Handle, 0)
+
+	// Keep cycling items until every slot is retired
+	for step := 0; ; step++ {
+
+		shouldFree := len(alive) > 0 && step%3 == 2
+		if !shouldFree {
+
+			_, h, err := r.New()
+			switch {
+			case errors.Is(err, ErrRegistryFull):
+				// Full means every slot is either alive or retired
+				shouldFree = true
+			case err != nil:
+				t.Fatalf("Failed to create item. Err: %v", err)
+			default:
+				alive = append(alive, h)
+			}
+		}
+
+		if shouldFree {
+
+			if len(alive) == 0 {
+				break
+			}
+
+			h := alive[0]
+			alive = alive[1:]
+			r.Free(h)
+			stale = append(stale, h)
+		}
+
+		for _, h := range stale {
+			if r.Get(h) != nil {
+				t.Fatalf("Stale handle %v resolved to an item on step %d", h, step)
+			}
+		}
+
+		for _, h := range alive {
+			if r.Get(h) == nil {
+				t.Fatalf("Alive handle %v did not resolve on step %d", h, step)
+			}
+		}
+	}
+
+	if r.RetiredSlotCount != slotCount {
+		t.Fatalf("Expected all %d slots to be retired, but got %d", slotCount, r.RetiredSlotCount)
+	}
+}
+
+func TestDenseRegistrySlotRetirement(t *testing.T) {
+
+	useHandleLayout(t, HandleLayout{GenerationBits: 3, IndexBits: 8})
+
+	r := NewDenseRegistryWithOptions[int](&RegistryOptions{
+		InitialSize:   1,
+		ChunkSize:     1,
+		MaxSize:       1,
+		DisableGrowth: true,
+	})
+
+	debugRetiredBefore := DebugRetiredSlotCount()
+
+	expectedUses := 1<<(3-1) - 1
+	staleHandles := make([]Handle, 0, expectedUses)
+	for i := 0; i < expectedUses; i++ {
+
+		_, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item on use %d. Err: %v", i, err)
+		}
+
+		for _, stale := range staleHandles {
+			if r.Get(stale) != nil {
+				t.Fatalf("Stale handle %v resolved to an item on use %d", stale, i)
+			}
+		}
+
+		r.Free(h)
+		staleHandles = append(staleHandles, h)
+	}
+
+	if r.RetiredSlotCount != 1 {
+		t.Fatalf("Expected 1 retired slot, but got %d", r.RetiredSlotCount)
+	}
+
+	if consts.Debug && DebugRetiredSlotCount() != debugRetiredBefore+1 {
+		t.Fatalf("Expected debug retired slot count to increase by 1, but went from %d to %d", debugRetiredBefore, DebugRetiredSlotCount())
+	}
+
+	if _, _, err := r.New(); !errors.Is(err, ErrRegistryFull) {
+		t.Fatalf("Expected ErrRegistryFull since the only slot is retired, but got %v", err)
+	}
+}
+
+func TestRegistryStaleFreeListEntryToRetiredSlot(t *testing.T) {
+
+	useHandleLayout(t, HandleLayout{GenerationBits: 4, IndexBits: 8})
+
+	r := NewRegistryWithOptions[int](&RegistryOptions{
+		InitialSize:   3,
+		ChunkSize:     3,
+		DisableGrowth: true,
+	})
+
+	// A high threshold makes New use the linear search, which always finds slot zero,
+	// so the free list keeps piling up entries to slot zero while it is cycled
+	r.FreeListUsageThreshold = math.MaxUint32
+
+	for i := 0; r.RetiredSlotCount == 0; i++ {
+
+		if i > 100 {
+			t.Fatalf("Slot never retired")
+		}
+
+		_, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item on cycle %d. Err: %v", i, err)
+		}
+
+		if h.Index() != 0 {
+			t.Fatalf("Expected slot zero to be cycled, but got slot %d", h.Index())
+		}
+
+		r.Free(h)
+	}
+
+	if r.FreeListSize == 0 {
+		t.Fatalf("Expected stale free list entries to the retired slot")
+	}
+
+	// Now the free list is used, and all its entries point to the retired slot so they must be skipped
+	r.FreeListUsageThreshold = 0
+	for i := 1; i < 3; i++ {
+
+		_, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		if h.IsZero() || r.Get(h) == nil || h.Index() != uint64(i) {
+			t.Fatalf("Expected a valid handle to slot %d, but got %v", i, h)
+		}
+	}
+
+	if _, h, err := r.New(); !errors.Is(err, ErrRegistryFull) {
+		t.Fatalf("Expected ErrRegistryFull since all other slots are alive, but got handle %v and err %v", h, err)
+	}
+}
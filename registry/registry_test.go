@@ -0,0 +1,241 @@
+package registry
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegistryPointersStableAcrossGrowth(t *testing.T) {
+
+	r := NewRegistry[int](4)
+
+	handles := make([]Handle, 0)
+	pointers := make([]*int, 0)
+	for i := 0; i < 50; i++ {
+
+		item, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		*item = i
+		handles = append(handles, h)
+		pointers = append(pointers, item)
+	}
+
+	if len(r.ItemChunks) < 10 || r.Cap() != uint(len(r.ItemChunks))*4 {
+		t.Fatalf("Expected the registry to grow in chunks of 4, but got %d chunks and %d slots", len(r.ItemChunks), r.Cap())
+	}
+
+	for i, h := range handles {
+
+		got := r.Get(h)
+		if got != pointers[i] {
+			t.Fatalf("Pointer of item %d changed after growing", i)
+		}
+
+		if *got != i {
+			t.Fatalf("Expected item %d to have value %d, but got %d", i, i, *got)
+		}
+	}
+
+	// Writes through old pointers are seen through the registry
+	*pointers[0] = 1000
+	if *r.Get(handles[0]) != 1000 {
+		t.Fatalf("Expected write through an old pointer to be visible")
+	}
+}
+
+func TestRegistryInitialSizeRoundsUp(t *testing.T) {
+
+	r := NewRegistryWithOptions[int](&RegistryOptions{
+		InitialSize: 5,
+		ChunkSize:   4,
+	})
+
+	if r.Cap() != 8 {
+		t.Fatalf("Expected initial size 5 to round up to 8 slots, but got %d", r.Cap())
+	}
+}
+
+func TestRegistryMaxSize(t *testing.T) {
+
+	r := NewRegistryWithOptions[int](&RegistryOptions{
+		InitialSize: 4,
+		ChunkSize:   4,
+		MaxSize:     12,
+	})
+
+	handles := make([]Handle, 0, 12)
+	for i := 0; i < 12; i++ {
+
+		_, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item %d. Err: %v", i, err)
+		}
+
+		handles = append(handles, h)
+	}
+
+	if _, _, err := r.New(); !errors.Is(err, ErrRegistryFull) {
+		t.Fatalf("Expected ErrRegistryFull once max size is reached, but got %v", err)
+	}
+
+	if r.Cap() != 12 || r.ItemCount != 12 {
+		t.Fatalf("Expected a failed New to not change the registry, but got %d slots and %d items", r.Cap(), r.ItemCount)
+	}
+
+	// Freed slots can still be used
+	r.Free(handles[5])
+	if _, h, err := r.New(); err != nil || h.Index() != handles[5].Index() {
+		t.Fatalf("Expected New to reuse the freed slot %d, but got handle %v and err %v", handles[5].Index(), h, err)
+	}
+}
+
+func TestRegistryDisableGrowth(t *testing.T) {
+
+	r := NewRegistryWithOptions[int](&RegistryOptions{
+		InitialSize:   8,
+		ChunkSize:     4,
+		DisableGrowth: true,
+	})
+
+	for i := 0; i < 8; i++ {
+		if _, _, err := r.New(); err != nil {
+			t.Fatalf("Failed to create item %d. Err: %v", i, err)
+		}
+	}
+
+	if _, _, err := r.New(); !errors.Is(err, ErrRegistryFull) {
+		t.Fatalf("Expected ErrRegistryFull with growth disabled, but got %v", err)
+	}
+
+	if r.Cap() != 8 {
+		t.Fatalf("Expected the registry to stay at 8 slots, but got %d", r.Cap())
+	}
+}
+
+func TestRegistryCallbackOrder(t *testing.T) {
+
+	r := NewRegistry[int](4)
+
+	events := make([]string, 0)
+	r.OnCreateCallbacks = append(r.OnCreateCallbacks,
+		func(item *int, h Handle) {
+			// The item is zeroed and the handle is alive when create callbacks run
+			if *item != 0 || r.Get(h) != item {
+				t.Errorf("Expected a zeroed alive item in the create callback")
+			}
+			*item = 7
+			events = append(events, "create 1")
+		},
+		func(item *int, h Handle) {
+			if *item != 7 {
+				t.Errorf("Expected create callbacks to run in order and see earlier changes")
+			}
+			events = append(events, "create 2")
+		},
+	)
+
+	r.OnFreeCallbacks = append(r.OnFreeCallbacks,
+		func(item *int, h Handle) {
+			// The item must still be alive while free callbacks run
+			if r.Get(h) != item || *item != 7 {
+				t.Errorf("Expected the item to be alive in the free callback")
+			}
+			events = append(events, "free 1")
+		},
+		func(item *int, h Handle) {
+			events = append(events, "free 2")
+		},
+	)
+
+	item, h, err := r.New()
+	if err != nil {
+		t.Fatalf("Failed to create item. Err: %v", err)
+	}
+
+	if *item != 7 {
+		t.Fatalf("Expected the item returned by New to have the value set in the create callback, but got %d", *item)
+	}
+
+	r.Free(h)
+
+	// Freeing a stale handle must not call the callbacks again
+	r.Free(h)
+
+	expected := []string{"create 1", "create 2", "free 1", "free 2"}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected events %v, but got %v", expected, events)
+	}
+
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("Expected events %v, but got %v", expected, events)
+		}
+	}
+}
+
+func TestRegistryFreeDeferred(t *testing.T) {
+
+	r := NewRegistry[int](4)
+
+	handles := make([]Handle, 6)
+	for i := range handles {
+
+		item, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		*item = i
+		handles[i] = h
+	}
+
+	// Freeing item 0 frees item 1 through a deferred free queued during the flush, which in turn frees item 2
+	freeOrder := make([]int, 0)
+	r.OnFreeCallbacks = append(r.OnFreeCallbacks, func(item *int, h Handle) {
+
+		freeOrder = append(freeOrder, *item)
+		if *item < 2 {
+			r.FreeDeferred(handles[*item+1])
+		}
+	})
+
+	r.FreeDeferred(handles[0])
+	r.FreeDeferred(handles[4])
+
+	// Also queue a duplicate, which must only be freed once
+	r.FreeDeferred(handles[4])
+
+	for i, h := range handles {
+		if r.Get(h) == nil {
+			t.Fatalf("Expected item %d to stay alive until FlushDeferred", i)
+		}
+	}
+
+	r.FlushDeferred()
+
+	for i, h := range handles {
+
+		shouldBeFreed := i <= 2 || i == 4
+		if (r.Get(h) == nil) != shouldBeFreed {
+			t.Fatalf("Expected item %d freed=%v after flushing, but got freed=%v", i, shouldBeFreed, r.Get(h) == nil)
+		}
+	}
+
+	expectedOrder := []int{0, 4, 1, 2}
+	if len(freeOrder) != len(expectedOrder) {
+		t.Fatalf("Expected free order %v, but got %v", expectedOrder, freeOrder)
+	}
+
+	for i := range expectedOrder {
+		if freeOrder[i] != expectedOrder[i] {
+			t.Fatalf("Expected free order %v, but got %v", expectedOrder, freeOrder)
+		}
+	}
+
+	if len(r.DeferredFrees) != 0 || r.ItemCount != 2 {
+		t.Fatalf("Expected an empty deferred queue and 2 items after flushing, but got %d queued and %d items", len(r.DeferredFrees), r.ItemCount)
+	}
+}
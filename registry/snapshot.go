@@ -0,0 +1,230 @@
+package registry
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+const (
+	snapshotMagic   uint32 = 0x4E_52_45_47 // 'NREG'
+	snapshotVersion uint32 = 3
+)
+
+var (
+	ErrInvalidSnapshot = errors.New("invalid registry snapshot")
+)
+
+// ItemCodec encodes and decodes registry items when writing and reading registry snapshots
+type ItemCodec[T any] interface {
+	Encode(w io.Writer, item *T) error
+	Decode(r io.Reader, item *T) error
+}
+
+var _ ItemCodec[uint64] = BinaryItemCodec[uint64]{}
+
+// BinaryItemCodec encodes items using encoding/binary, and as such only works with fixed size types (e.g. numbers and structs of numbers)
+type BinaryItemCodec[T any] struct{}
+
+func (BinaryItemCodec[T]) Encode(w io.Writer, item *T) error {
+	return binary.Write(w, binary.LittleEndian, item)
+}
+
+func (BinaryItemCodec[T]) Decode(r io.Reader, item *T) error {
+	return binary.Read(r, binary.LittleEndian, item)
+}
+
+type snapshotHeader struct {
+	Magic   uint32
+	Version uint32
+
+	GenerationBits uint8
+	IndexBits      uint8
+
+	ChunkSize              uint32
+	MaxSize                uint32
+	DisableGrowth          bool
+	FreeListUsageThreshold uint32
+
+	ItemCount        uint64
+	RetiredSlotCount uint64
+	SlotCount        uint64
+	FreeListSize     uint32
+}
+
+// WriteSnapshot writes the full state of the registry (handles, generations, flags, free list and alive items) to w.
+// Items are written using the passed codec. Stale free list entries are dropped.
+//
+// A registry read using ReadSnapshot resolves all handles the same way this registry does
+func (r *Registry[T]) WriteSnapshot(w io.Writer, codec ItemCodec[T]) error {
+
+	header := snapshotHeader{
+		Magic:   snapshotMagic,
+		Version: snapshotVersion,
+
+		GenerationBits: handleLayout.GenerationBits,
+		IndexBits:      handleLayout.IndexBits,
+
+		ChunkSize:              r.ChunkSize,
+		MaxSize:                r.MaxSize,
+		DisableGrowth:          r.DisableGrowth,
+		FreeListUsageThreshold: r.FreeListUsageThreshold,
+
+		ItemCount:        uint64(r.ItemCount),
+		RetiredSlotCount: uint64(r.RetiredSlotCount),
+		SlotCount:        uint64(len(r.Handles)),
+	}
+
+	// The free list can have stale entries (slots alive again or retired, and repeats of the same slot), which New skips anyway.
+	// Only usable entries are written, which keeps the free list at most one entry per slot.
+	// Free list is written from head to tail so the order is kept on read
+	freeList := make([]uint64, 0, r.FreeListSize)
+	isInFreeList := make(map[uint64]struct{}, r.FreeListSize)
+	for fl := r.FreeList; fl != nil; fl = fl.nextFree {
+
+		h := r.Handles[fl.ItemIndex]
+		if h.HasFlag(HandleFlag_Alive) || h.HasFlag(HandleFlag_Retired) {
+			continue
+		}
+
+		if _, ok := isInFreeList[fl.ItemIndex]; ok {
+			continue
+		}
+
+		isInFreeList[fl.ItemIndex] = struct{}{}
+		freeList = append(freeList, fl.ItemIndex)
+	}
+	header.FreeListSize = uint32(len(freeList))
+
+	err := binary.Write(w, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(w, binary.LittleEndian, r.Handles)
+	if err != nil {
+		return err
+	}
+
+	err = binary.Write(w, binary.LittleEndian, freeList)
+	if err != nil {
+		return err
+	}
+
+	// Only alive items are written, and they are written in slot order
+	for i := 0; i < len(r.Handles); i++ {
+
+		if !r.Handles[i].HasFlag(HandleFlag_Alive) {
+			continue
+		}
+
+		err = codec.Encode(w, r.itemAt(uint64(i)))
+		if err != nil {
+			return fmt.Errorf("failed to encode registry item at index %d. Err: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// ReadSnapshot creates a new registry from a snapshot written by WriteSnapshot.
+// Items are read using the passed codec, which should match the one used to write the snapshot
+func ReadSnapshot[T any](rd io.Reader, codec ItemCodec[T]) (*Registry[T], error) {
+
+	header := snapshotHeader{}
+	err := binary.Read(rd, binary.LittleEndian, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Magic != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic number %x", ErrInvalidSnapshot, header.Magic)
+	}
+
+	if header.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, header.Version)
+	}
+
+	if header.GenerationBits != handleLayout.GenerationBits || header.IndexBits != handleLayout.IndexBits {
+		return nil, fmt.Errorf("%w: snapshot handle layout %d/%d does not match current handle layout %d/%d", ErrInvalidSnapshot, header.GenerationBits, header.IndexBits, handleLayout.GenerationBits, handleLayout.IndexBits)
+	}
+
+	if header.ChunkSize == 0 || header.SlotCount == 0 || header.SlotCount%uint64(header.ChunkSize) != 0 || header.SlotCount-1 > indexBitMask ||
+		header.ItemCount+header.RetiredSlotCount > header.SlotCount || uint64(header.FreeListSize) > header.SlotCount {
+		return nil, fmt.Errorf("%w: bad sizes in header %+v", ErrInvalidSnapshot, header)
+	}
+
+	atomic.StoreUint32(&handleLayoutInUse, 1)
+
+	chunkCount := header.SlotCount / uint64(header.ChunkSize)
+	r := &Registry[T]{
+		ItemCount:              uint(header.ItemCount),
+		RetiredSlotCount:       uint(header.RetiredSlotCount),
+		Handles:                make([]Handle, header.SlotCount),
+		ItemChunks:             make([][]T, chunkCount),
+		ChunkSize:              header.ChunkSize,
+		MaxSize:                header.MaxSize,
+		DisableGrowth:          header.DisableGrowth,
+		FreeListUsageThreshold: header.FreeListUsageThreshold,
+	}
+
+	for i := uint64(0); i < chunkCount; i++ {
+		r.ItemChunks[i] = make([]T, header.ChunkSize)
+	}
+
+	err = binary.Read(rd, binary.LittleEndian, r.Handles)
+	if err != nil {
+		return nil, err
+	}
+
+	freeList := make([]uint64, header.FreeListSize)
+	err = binary.Read(rd, binary.LittleEndian, freeList)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rebuild the free list from tail to head so it ends up in the same order it was written in
+	for i := len(freeList) - 1; i >= 0; i-- {
+
+		if freeList[i] >= header.SlotCount {
+			return nil, fmt.Errorf("%w: free list index %d is out of range", ErrInvalidSnapshot, freeList[i])
+		}
+
+		if r.Handles[freeList[i]].HasFlag(HandleFlag_Alive) || r.Handles[freeList[i]].HasFlag(HandleFlag_Retired) {
+			return nil, fmt.Errorf("%w: free list index %d is not a free slot", ErrInvalidSnapshot, freeList[i])
+		}
+
+		r.FreeList = &freeListitem{
+			ItemIndex: freeList[i],
+			nextFree:  r.FreeList,
+		}
+	}
+	r.FreeListSize = header.FreeListSize
+
+	var aliveCount uint64
+	for i := 0; i < len(r.Handles); i++ {
+
+		if !r.Handles[i].HasFlag(HandleFlag_Alive) {
+			continue
+		}
+
+		if r.Handles[i].Index() != uint64(i) {
+			return nil, fmt.Errorf("%w: handle at index %d has index %d", ErrInvalidSnapshot, i, r.Handles[i].Index())
+		}
+
+		err = codec.Decode(rd, r.itemAt(uint64(i)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode registry item at index %d. Err: %w", i, err)
+		}
+
+		aliveCount++
+	}
+
+	if aliveCount != header.ItemCount {
+		return nil, fmt.Errorf("%w: header has %d items but found %d alive handles", ErrInvalidSnapshot, header.ItemCount, aliveCount)
+	}
+
+	return r, nil
+}
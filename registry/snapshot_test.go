@@ -0,0 +1,273 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// Byte offsets of header fields, which binary.Write packs without padding
+const (
+	snapshotMagicOffset        = 0
+	snapshotVersionOffset      = 4
+	snapshotSlotCountOffset    = 39
+	snapshotFreeListSizeOffset = 47
+	snapshotHeaderSize         = 51
+)
+
+func writeTestSnapshot(t *testing.T, r *Registry[uint64]) []byte {
+
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	err := r.WriteSnapshot(buf, BinaryItemCodec[uint64]{})
+	if err != nil {
+		t.Fatalf("Failed to write snapshot. Err: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// checkSnapshotRoundTrip writes and reads the registry, and checks that all passed handles resolve the same way in both
+func checkSnapshotRoundTrip(t *testing.T, r *Registry[uint64], handles []Handle) *Registry[uint64] {
+
+	t.Helper()
+
+	data := writeTestSnapshot(t, r)
+	read, err := ReadSnapshot[uint64](bytes.NewReader(data), BinaryItemCodec[uint64]{})
+	if err != nil {
+		t.Fatalf("Failed to read snapshot. Err: %v", err)
+	}
+
+	if read.ItemCount != r.ItemCount || read.RetiredSlotCount != r.RetiredSlotCount || len(read.Handles) != len(r.Handles) {
+		t.Fatalf("Expected item/retired/slot counts %d/%d/%d, but got %d/%d/%d", r.ItemCount, r.RetiredSlotCount, len(r.Handles), read.ItemCount, read.RetiredSlotCount, len(read.Handles))
+	}
+
+	for i := range r.Handles {
+		if read.Handles[i] != r.Handles[i] {
+			t.Fatalf("Expected handle %v at slot %d, but got %v", r.Handles[i], i, read.Handles[i])
+		}
+	}
+
+	for _, h := range handles {
+
+		orig := r.Get(h)
+		got := read.Get(h)
+		if (orig == nil) != (got == nil) || (orig != nil && *orig != *got) {
+			t.Fatalf("Handle %v resolves to %v in the original registry but to %v in the read one", h, orig, got)
+		}
+	}
+
+	if read.FreeListSize > uint32(len(read.Handles)) {
+		t.Fatalf("Expected the read free list to have at most one entry per slot, but it has %d entries for %d slots", read.FreeListSize, len(read.Handles))
+	}
+
+	// Reading the same snapshot again must give identical output, since the free list was already compacted
+	if again := writeTestSnapshot(t, read); !bytes.Equal(again, data) {
+		t.Fatalf("Expected writing a read snapshot to give identical bytes")
+	}
+
+	return read
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+
+	r := NewRegistry[uint64](8)
+	handles := make([]Handle, 0)
+	for i := 0; i < 20; i++ {
+
+		item, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		*item = uint64(i * 100)
+		handles = append(handles, h)
+	}
+
+	for i := 0; i < len(handles); i += 3 {
+		r.Free(handles[i])
+	}
+
+	read := checkSnapshotRoundTrip(t, r, handles)
+
+	// New items in the read registry must not reuse alive slots
+	for i := 0; i < 10; i++ {
+
+		_, h, err := read.New()
+		if err != nil {
+			t.Fatalf("Failed to create item in read registry. Err: %v", err)
+		}
+
+		for _, old := range handles {
+			if old.Index() == h.Index() && r.Get(old) != nil {
+				t.Fatalf("New handle %v reused the slot of alive handle %v", h, old)
+			}
+		}
+	}
+}
+
+func TestSnapshotLongFreeList(t *testing.T) {
+
+	r := NewRegistryWithOptions[uint64](&RegistryOptions{
+		InitialSize:   10,
+		ChunkSize:     10,
+		DisableGrowth: true,
+	})
+
+	handles := make([]Handle, 0)
+	for i := 0; i < 40; i++ {
+
+		item, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		*item = uint64(i)
+		handles = append(handles, h)
+		r.Free(h)
+	}
+
+	// A couple of alive items so that not all slots are free
+	for i := 0; i < 2; i++ {
+
+		item, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		*item = uint64(1000 + i)
+		handles = append(handles, h)
+	}
+
+	if r.FreeListSize <= uint32(len(r.Handles)) {
+		t.Fatalf("Expected the free list to have more entries than slots, but it has %d entries for %d slots", r.FreeListSize, len(r.Handles))
+	}
+
+	checkSnapshotRoundTrip(t, r, handles)
+}
+
+func TestSnapshotCustomLayoutWithRetiredSlots(t *testing.T) {
+
+	hl := HandleLayout{GenerationBits: 4, IndexBits: 12}
+	useHandleLayout(t, hl)
+
+	r := NewRegistryWithOptions[uint64](&RegistryOptions{
+		InitialSize:   4,
+		ChunkSize:     4,
+		DisableGrowth: true,
+	})
+
+	// Retire two slots
+	handles := make([]Handle, 0)
+	for r.RetiredSlotCount < 2 {
+
+		_, a, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		_, b, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		handles = append(handles, a, b)
+		r.Free(a)
+		r.Free(b)
+	}
+
+	item, h, err := r.New()
+	if err != nil {
+		t.Fatalf("Failed to create item. Err: %v", err)
+	}
+	*item = 42
+	handles = append(handles, h)
+
+	read := checkSnapshotRoundTrip(t, r, handles)
+
+	// Only the one remaining free slot can be used
+	if _, _, err := read.New(); err != nil {
+		t.Fatalf("Failed to create item in the last free slot. Err: %v", err)
+	}
+
+	if _, _, err := read.New(); !errors.Is(err, ErrRegistryFull) {
+		t.Fatalf("Expected ErrRegistryFull since the other slots are alive or retired, but got %v", err)
+	}
+
+	// A snapshot can't be read using another layout
+	data := writeTestSnapshot(t, r)
+	useHandleLayout(t, HandleLayout{GenerationBits: 8, IndexBits: 12})
+	if _, err := ReadSnapshot[uint64](bytes.NewReader(data), BinaryItemCodec[uint64]{}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Fatalf("Expected ErrInvalidSnapshot for a layout mismatch, but got %v", err)
+	}
+}
+
+func TestSnapshotInvalidInput(t *testing.T) {
+
+	r := NewRegistry[uint64](4)
+	handles := make([]Handle, 0, 6)
+	for i := 0; i < 6; i++ {
+
+		item, h, err := r.New()
+		if err != nil {
+			t.Fatalf("Failed to create item. Err: %v", err)
+		}
+
+		*item = uint64(i)
+		handles = append(handles, h)
+	}
+
+	for i := 0; i < len(handles); i += 2 {
+		r.Free(handles[i])
+	}
+
+	data := writeTestSnapshot(t, r)
+	if r.FreeListSize == 0 {
+		t.Fatalf("Expected a non-empty free list")
+	}
+
+	read := func(d []byte) error {
+		_, err := ReadSnapshot[uint64](bytes.NewReader(d), BinaryItemCodec[uint64]{})
+		return err
+	}
+
+	if err := read(data); err != nil {
+		t.Fatalf("Failed to read valid snapshot. Err: %v", err)
+	}
+
+	for i := 0; i < len(data); i++ {
+		if err := read(data[:i]); err == nil {
+			t.Fatalf("Expected an error when reading a snapshot truncated to %d of %d bytes", i, len(data))
+		}
+	}
+
+	corrupt := func(name string, offset int, val any) {
+
+		t.Helper()
+
+		d := append([]byte{}, data...)
+		buf := &bytes.Buffer{}
+		binary.Write(buf, binary.LittleEndian, val)
+		copy(d[offset:], buf.Bytes())
+
+		if err := read(d); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Fatalf("%s: expected ErrInvalidSnapshot, but got %v", name, err)
+		}
+	}
+
+	corrupt("magic", snapshotMagicOffset, uint32(0x1234))
+	corrupt("version", snapshotVersionOffset, snapshotVersion+1)
+	corrupt("zero slot count", snapshotSlotCountOffset, uint64(0))
+	corrupt("huge slot count", snapshotSlotCountOffset, uint64(1)<<62)
+	corrupt("free list longer than slot count", snapshotFreeListSizeOffset, uint32(1000))
+
+	// Free list entries come right after the handles
+	freeListOffset := snapshotHeaderSize + len(r.Handles)*8
+	corrupt("free list index out of range", freeListOffset, uint64(1000))
+	corrupt("free list index of alive slot", freeListOffset, r.Handles[1].Index())
+
+	// Handle of slot one, which is alive, pointing at another index
+	corrupt("handle index mismatch", snapshotHeaderSize+8, NewHandle(1, 3))
+}
@@ -0,0 +1,389 @@
+package systems
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/bloeys/nmage/assert"
+	"github.com/bloeys/nmage/logging"
+)
+
+type Phase int32
+
+const (
+	Phase_PreUpdate Phase = iota
+	Phase_FixedUpdate
+	Phase_Update
+	Phase_LateUpdate
+	Phase_PreRender
+
+	Phase_Count
+)
+
+func (p Phase) String() string {
+
+	switch p {
+	case Phase_PreUpdate:
+		return "PreUpdate"
+	case Phase_FixedUpdate:
+		return "FixedUpdate"
+	case Phase_Update:
+		return "Update"
+	case Phase_LateUpdate:
+		return "LateUpdate"
+	case Phase_PreRender:
+		return "PreRender"
+	default:
+		return fmt.Sprintf("Phase(%d)", int32(p))
+	}
+}
+
+var (
+	ErrDuplicateSystem = errors.New("duplicate system name")
+	ErrUnknownSystem   = errors.New("unknown system name in ordering constraint")
+	ErrSystemCycle     = errors.New("cycle in system ordering constraints")
+)
+
+// System describes a system that runs once per phase.
+//
+// Reads and Writes are the component types the system accesses. Systems in the same phase that don't
+// conflict (i.e. neither writes what the other reads or writes) can run in parallel.
+//
+// After and Before are names of systems in the same phase that this system must run after/before
+type System struct {
+	Name  string
+	Phase Phase
+
+	Reads  []reflect.Type
+	Writes []reflect.Type
+
+	After  []string
+	Before []string
+
+	// MainThreadOnly systems are never run in parallel, and always run on the calling (main) thread.
+	// This must be set for systems that make GL calls
+	MainThreadOnly bool
+
+	Run func()
+}
+
+// CompType returns the reflect.Type of T, and is used to fill System.Reads and System.Writes
+func CompType[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func (s *System) conflictsWith(other *System) bool {
+	return s.MainThreadOnly || other.MainThreadOnly || s.accessConflictsWith(other)
+}
+
+// accessConflictsWith reports whether either system writes components the other reads or writes
+func (s *System) accessConflictsWith(other *System) bool {
+
+	for _, w := range s.Writes {
+		if containsType(other.Reads, w) || containsType(other.Writes, w) {
+			return true
+		}
+	}
+
+	for _, w := range other.Writes {
+		if containsType(s.Reads, w) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsType(types []reflect.Type, t reflect.Type) bool {
+
+	for i := 0; i < len(types); i++ {
+		if types[i] == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// batch is a set of systems that don't conflict and so can run in parallel
+type batch struct {
+	systems []*System
+}
+
+// Scheduler runs registered systems by phase. Build must be called after all systems are registered
+// and before the first call to RunPhase
+type Scheduler struct {
+	systems []*System
+	batches [Phase_Count][]batch
+	isBuilt bool
+}
+
+func (s *Scheduler) Register(sys System) {
+
+	assert.T(sys.Name != "", "System name can not be empty")
+	assert.T(sys.Phase >= 0 && sys.Phase < Phase_Count, "System '%s' has invalid phase %d", sys.Name, sys.Phase)
+	assert.T(sys.Run != nil, "System '%s' has no run function", sys.Name)
+
+	s.systems = append(s.systems, &sys)
+	s.isBuilt = false
+}
+
+// Build validates ordering constraints and computes the execution order of all phases.
+//
+// Unknown system names and cycles in ordering constraints are returned as errors. Conflicting systems
+// that have no ordering between them are run in registration order, and a warning is logged for each such pair
+func (s *Scheduler) Build() error {
+
+	for phase := Phase(0); phase < Phase_Count; phase++ {
+
+		phaseSystems := make([]*System, 0)
+		for _, sys := range s.systems {
+			if sys.Phase == phase {
+				phaseSystems = append(phaseSystems, sys)
+			}
+		}
+
+		batches, err := buildPhase(phaseSystems)
+		if err != nil {
+			return fmt.Errorf("failed to build systems of phase '%s'. Err: %w", phase, err)
+		}
+
+		s.batches[phase] = batches
+	}
+
+	s.isBuilt = true
+	return nil
+}
+
+func buildPhase(phaseSystems []*System) ([]batch, error) {
+
+	indices := make(map[string]int, len(phaseSystems))
+	for i, sys := range phaseSystems {
+
+		if _, ok := indices[sys.Name]; ok {
+			return nil, fmt.Errorf("%w: '%s'", ErrDuplicateSystem, sys.Name)
+		}
+
+		indices[sys.Name] = i
+	}
+
+	// edges[i][j] means i must run before j
+	n := len(phaseSystems)
+	edges := make([][]bool, n)
+	for i := 0; i < n; i++ {
+		edges[i] = make([]bool, n)
+	}
+
+	for i, sys := range phaseSystems {
+
+		for _, name := range sys.After {
+
+			j, ok := indices[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: system '%s' runs after '%s'", ErrUnknownSystem, sys.Name, name)
+			}
+
+			edges[j][i] = true
+		}
+
+		for _, name := range sys.Before {
+
+			j, ok := indices[name]
+			if !ok {
+				return nil, fmt.Errorf("%w: system '%s' runs before '%s'", ErrUnknownSystem, sys.Name, name)
+			}
+
+			edges[i][j] = true
+		}
+	}
+
+	if cycle := findCycle(edges, phaseSystems); cycle != "" {
+		return nil, fmt.Errorf("%w: %s", ErrSystemCycle, cycle)
+	}
+
+	// Conflicting systems with no ordering between them are ordered by registration.
+	// An edge is only added when there is no path in the opposite direction, so this can't create a cycle
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+
+			if !phaseSystems[i].conflictsWith(phaseSystems[j]) || isReachable(edges, i, j) || isReachable(edges, j, i) {
+				continue
+			}
+
+			// Main thread only systems conflict with everything, but that alone doesn't need explicit ordering
+			if phaseSystems[i].accessConflictsWith(phaseSystems[j]) {
+				logging.WarnLog.Printf("Systems '%s' and '%s' access the same components but have no ordering between them. They will run in registration order\n", phaseSystems[i].Name, phaseSystems[j].Name)
+			}
+
+			edges[i][j] = true
+		}
+	}
+
+	// Kahn's algorithm, where every level of the graph becomes a batch
+	inDegree := make([]int, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if edges[i][j] {
+				inDegree[j]++
+			}
+		}
+	}
+
+	batches := make([]batch, 0)
+	done := 0
+	for done < n {
+
+		b := batch{systems: make([]*System, 0)}
+		ready := make([]int, 0)
+		for i := 0; i < n; i++ {
+			if inDegree[i] == 0 {
+				ready = append(ready, i)
+			}
+		}
+
+		for _, i := range ready {
+			inDegree[i] = -1
+			b.systems = append(b.systems, phaseSystems[i])
+			for j := 0; j < n; j++ {
+				if edges[i][j] {
+					inDegree[j]--
+				}
+			}
+		}
+
+		done += len(ready)
+		batches = append(batches, b)
+	}
+
+	return batches, nil
+}
+
+func isReachable(edges [][]bool, from, to int) bool {
+
+	visited := make([]bool, len(edges))
+	stack := []int{from}
+	for len(stack) > 0 {
+
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if curr == to {
+			return true
+		}
+
+		if visited[curr] {
+			continue
+		}
+		visited[curr] = true
+
+		for next := 0; next < len(edges); next++ {
+			if edges[curr][next] && !visited[next] {
+				stack = append(stack, next)
+			}
+		}
+	}
+
+	return false
+}
+
+// findCycle returns a description of a cycle in the graph, or an empty string if there is none
+func findCycle(edges [][]bool, phaseSystems []*System) string {
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make([]int, len(edges))
+	path := make([]int, 0)
+
+	var visit func(i int) string
+	visit = func(i int) string {
+
+		state[i] = visiting
+		path = append(path, i)
+
+		for j := 0; j < len(edges); j++ {
+
+			if !edges[i][j] {
+				continue
+			}
+
+			if state[j] == visiting {
+
+				names := make([]string, 0)
+				for k := len(path) - 1; k >= 0; k-- {
+					names = append([]string{phaseSystems[path[k]].Name}, names...)
+					if path[k] == j {
+						break
+					}
+				}
+
+				return strings.Join(append(names, phaseSystems[j].Name), " -> ")
+			}
+
+			if state[j] == unvisited {
+				if cycle := visit(j); cycle != "" {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[i] = visited
+		return ""
+	}
+
+	for i := 0; i < len(edges); i++ {
+
+		if state[i] != unvisited {
+			continue
+		}
+
+		if cycle := visit(i); cycle != "" {
+			return cycle
+		}
+	}
+
+	return ""
+}
+
+// RunPhase runs all systems of the phase and returns once they are all done
+func (s *Scheduler) RunPhase(phase Phase) {
+
+	assert.T(s.isBuilt, "Scheduler.Build must be called after registering systems and before running them")
+
+	wg := sync.WaitGroup{}
+	for _, b := range s.batches[phase] {
+
+		// Main thread systems never share a batch with other systems as they conflict with everything
+		if len(b.systems) == 1 {
+			b.systems[0].Run()
+			continue
+		}
+
+		wg.Add(len(b.systems))
+		for _, sys := range b.systems {
+
+			go func(sys *System) {
+				defer wg.Done()
+				sys.Run()
+			}(sys)
+		}
+
+		wg.Wait()
+	}
+}
+
+func (s *Scheduler) IsBuilt() bool {
+	return s.isBuilt
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		systems: make([]*System, 0),
+	}
+}
@@ -0,0 +1,197 @@
+package systems
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type posComp struct{}
+type velComp struct{}
+type healthComp struct{}
+
+func noop() {}
+
+// batchNames returns the names of the systems in every batch of the phase
+func batchNames(s *Scheduler, phase Phase) [][]string {
+
+	out := make([][]string, 0, len(s.batches[phase]))
+	for _, b := range s.batches[phase] {
+
+		names := make([]string, 0, len(b.systems))
+		for _, sys := range b.systems {
+			names = append(names, sys.Name)
+		}
+
+		out = append(out, names)
+	}
+
+	return out
+}
+
+func TestSchedulerBatchesIndependentSystems(t *testing.T) {
+
+	s := NewScheduler()
+	s.Register(System{Name: "movement", Phase: Phase_Update, Reads: []reflect.Type{CompType[velComp]()}, Writes: []reflect.Type{CompType[posComp]()}, Run: noop})
+	s.Register(System{Name: "regen", Phase: Phase_Update, Writes: []reflect.Type{CompType[healthComp]()}, Run: noop})
+	s.Register(System{Name: "velocity reader", Phase: Phase_Update, Reads: []reflect.Type{CompType[velComp]()}, Run: noop})
+	s.Register(System{Name: "late", Phase: Phase_LateUpdate, Writes: []reflect.Type{CompType[posComp]()}, Run: noop})
+
+	err := s.Build()
+	if err != nil {
+		t.Fatalf("Failed to build. Err: %v", err)
+	}
+
+	// Readers of the same type don't conflict, and systems in other phases don't affect this one
+	expected := [][]string{{"movement", "regen", "velocity reader"}}
+	if got := batchNames(s, Phase_Update); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected batches %v, but got %v", expected, got)
+	}
+
+	if got := batchNames(s, Phase_LateUpdate); !reflect.DeepEqual(got, [][]string{{"late"}}) {
+		t.Fatalf("Expected the late update phase to only have 'late', but got %v", got)
+	}
+
+	// Independent systems really do run in parallel: each waits until all of them have started
+	started := sync.WaitGroup{}
+	started.Add(3)
+	parallel := NewScheduler()
+	for _, name := range []string{"a", "b", "c"} {
+		parallel.Register(System{Name: name, Phase: Phase_Update, Run: func() {
+			started.Done()
+			started.Wait()
+		}})
+	}
+
+	if err = parallel.Build(); err != nil {
+		t.Fatalf("Failed to build. Err: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		parallel.RunPhase(Phase_Update)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Independent systems did not run in parallel")
+	}
+}
+
+func TestSchedulerSerializesConflicts(t *testing.T) {
+
+	order := make([]string, 0)
+	orderLock := sync.Mutex{}
+	record := func(name string) func() {
+		return func() {
+			orderLock.Lock()
+			order = append(order, name)
+			orderLock.Unlock()
+		}
+	}
+
+	s := NewScheduler()
+	s.Register(System{Name: "writer 1", Phase: Phase_Update, Writes: []reflect.Type{CompType[posComp]()}, Run: record("writer 1")})
+	s.Register(System{Name: "reader", Phase: Phase_Update, Reads: []reflect.Type{CompType[posComp]()}, Run: record("reader")})
+	s.Register(System{Name: "writer 2", Phase: Phase_Update, Writes: []reflect.Type{CompType[posComp]()}, Run: record("writer 2")})
+	s.Register(System{Name: "main thread", Phase: Phase_Update, MainThreadOnly: true, Run: record("main thread")})
+
+	err := s.Build()
+	if err != nil {
+		t.Fatalf("Failed to build. Err: %v", err)
+	}
+
+	expected := [][]string{{"writer 1"}, {"reader"}, {"writer 2"}, {"main thread"}}
+	if got := batchNames(s, Phase_Update); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected conflicting systems in registration order %v, but got %v", expected, got)
+	}
+
+	s.RunPhase(Phase_Update)
+	if !reflect.DeepEqual(order, []string{"writer 1", "reader", "writer 2", "main thread"}) {
+		t.Fatalf("Expected systems to run in registration order, but got %v", order)
+	}
+
+	// Explicit ordering wins over registration order
+	s = NewScheduler()
+	s.Register(System{Name: "writer 1", Phase: Phase_Update, Writes: []reflect.Type{CompType[posComp]()}, After: []string{"writer 2"}, Run: noop})
+	s.Register(System{Name: "writer 2", Phase: Phase_Update, Writes: []reflect.Type{CompType[posComp]()}, Run: noop})
+
+	if err = s.Build(); err != nil {
+		t.Fatalf("Failed to build. Err: %v", err)
+	}
+
+	expected = [][]string{{"writer 2"}, {"writer 1"}}
+	if got := batchNames(s, Phase_Update); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected explicit ordering %v, but got %v", expected, got)
+	}
+}
+
+func TestSchedulerErrors(t *testing.T) {
+
+	s := NewScheduler()
+	s.Register(System{Name: "a", Phase: Phase_Update, After: []string{"missing"}, Run: noop})
+	if err := s.Build(); !errors.Is(err, ErrUnknownSystem) {
+		t.Fatalf("Expected ErrUnknownSystem for an unknown After name, but got %v", err)
+	}
+
+	s = NewScheduler()
+	s.Register(System{Name: "a", Phase: Phase_Update, Before: []string{"missing"}, Run: noop})
+	if err := s.Build(); !errors.Is(err, ErrUnknownSystem) {
+		t.Fatalf("Expected ErrUnknownSystem for an unknown Before name, but got %v", err)
+	}
+
+	// Ordering only applies within a phase, so a system in another phase is unknown
+	s = NewScheduler()
+	s.Register(System{Name: "a", Phase: Phase_Update, After: []string{"b"}, Run: noop})
+	s.Register(System{Name: "b", Phase: Phase_LateUpdate, Run: noop})
+	if err := s.Build(); !errors.Is(err, ErrUnknownSystem) {
+		t.Fatalf("Expected ErrUnknownSystem for a system in another phase, but got %v", err)
+	}
+
+	s = NewScheduler()
+	s.Register(System{Name: "a", Phase: Phase_Update, Run: noop})
+	s.Register(System{Name: "a", Phase: Phase_Update, Run: noop})
+	if err := s.Build(); !errors.Is(err, ErrDuplicateSystem) {
+		t.Fatalf("Expected ErrDuplicateSystem, but got %v", err)
+	}
+
+	if s.IsBuilt() {
+		t.Fatalf("Expected a failed build to leave the scheduler unbuilt")
+	}
+}
+
+func TestSchedulerCycleDetection(t *testing.T) {
+
+	s := NewScheduler()
+	s.Register(System{Name: "a", Phase: Phase_Update, Before: []string{"b"}, Run: noop})
+	s.Register(System{Name: "b", Phase: Phase_Update, Before: []string{"c"}, Run: noop})
+	s.Register(System{Name: "c", Phase: Phase_Update, Before: []string{"a"}, Run: noop})
+	s.Register(System{Name: "unrelated", Phase: Phase_Update, Run: noop})
+
+	err := s.Build()
+	if !errors.Is(err, ErrSystemCycle) {
+		t.Fatalf("Expected ErrSystemCycle, but got %v", err)
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("Expected the cycle error to name system '%s', but got: %v", name, err)
+		}
+	}
+
+	if strings.Contains(err.Error(), "unrelated") {
+		t.Fatalf("Expected the cycle error to only name systems in the cycle, but got: %v", err)
+	}
+
+	// A system ordered after itself is a cycle too
+	s = NewScheduler()
+	s.Register(System{Name: "self", Phase: Phase_Update, After: []string{"self"}, Run: noop})
+	if err = s.Build(); !errors.Is(err, ErrSystemCycle) {
+		t.Fatalf("Expected ErrSystemCycle for a self ordering, but got %v", err)
+	}
+}
@@ -1,7 +1,10 @@
 package timing
 
 import (
+	"math"
 	"time"
+
+	"github.com/bloeys/nmage/assert"
 )
 
 var (
@@ -14,8 +17,35 @@ var (
 	lastElapsedTime          uint64  = 0
 	framesSinceLastFPSUpdate uint    = 0
 	avgFps                   float32 = 1
+
+	//fixed step vars
+	fixedDT               float32 = 1.0 / 60
+	fixedDTAccum          float32 = 0
+	maxFixedStepsPerFrame int     = 8
+	interpolationAlpha    float32 = 0
+
+	//frame pacing vars
+	pacingStats PacingStats
 )
 
+//PacingStats describes how well frames are being paced by WaitForFrameTime. Times are for the last frame unless stated otherwise
+type PacingStats struct {
+	//TargetFrameTime is zero if frames are not being limited
+	TargetFrameTime time.Duration
+
+	//WorkTime is the frame time before waiting
+	WorkTime  time.Duration
+	SleepTime time.Duration
+	SpinTime  time.Duration
+
+	//Overshoot is how late the frame ended compared to the target frame time, and MaxOvershoot is the worst since the last reset
+	Overshoot    time.Duration
+	MaxOvershoot time.Duration
+
+	//MissedFrames is the number of frames since the last reset whose work took longer than the target frame time
+	MissedFrames uint64
+}
+
 func Init() {
 	startTime = time.Now()
 }
@@ -47,6 +77,72 @@ func FrameEnded() {
 	}
 }
 
+//FrameEndedWithDT is like FrameEnded but uses the passed dt instead of the measured frame time
+func FrameEndedWithDT(newDT float32) {
+	assert.T(newDT > 0, "DT must be more than zero, but got %f", newDT)
+	dt = newDT
+}
+
+//TimeSinceFrameStart is the real time passed since FrameStarted was called
+func TimeSinceFrameStart() time.Duration {
+	return time.Since(frameStart)
+}
+
+//WaitForFrameTime blocks until at least targetFrameTime has passed since FrameStarted, and should be called just before FrameEnded.
+//
+//Most of the wait is spent sleeping, but the last spinThreshold of it is spent spinning because sleeps can wake up late.
+//A larger threshold is more accurate but uses more CPU. A targetFrameTime of zero or less doesn't wait
+func WaitForFrameTime(targetFrameTime, spinThreshold time.Duration) {
+
+	workTime := time.Since(frameStart)
+
+	pacingStats.TargetFrameTime = targetFrameTime
+	pacingStats.WorkTime = workTime
+	pacingStats.SleepTime = 0
+	pacingStats.SpinTime = 0
+	pacingStats.Overshoot = 0
+
+	if targetFrameTime <= 0 {
+		pacingStats.TargetFrameTime = 0
+		return
+	}
+
+	if workTime >= targetFrameTime {
+		pacingStats.MissedFrames++
+		return
+	}
+
+	deadline := frameStart.Add(targetFrameTime)
+
+	sleepStart := time.Now()
+	if sleepTime := deadline.Sub(sleepStart) - spinThreshold; sleepTime > 0 {
+		time.Sleep(sleepTime)
+	}
+
+	spinStart := time.Now()
+	for time.Now().Before(deadline) {
+	}
+
+	end := time.Now()
+	pacingStats.SleepTime = spinStart.Sub(sleepStart)
+	pacingStats.SpinTime = end.Sub(spinStart)
+	pacingStats.Overshoot = end.Sub(deadline)
+	if pacingStats.Overshoot > pacingStats.MaxOvershoot {
+		pacingStats.MaxOvershoot = pacingStats.Overshoot
+	}
+}
+
+//GetPacingStats returns the frame pacing stats updated by WaitForFrameTime
+func GetPacingStats() PacingStats {
+	return pacingStats
+}
+
+//ResetPacingStats resets the stats that accumulate over multiple frames, like MaxOvershoot and MissedFrames
+func ResetPacingStats() {
+	pacingStats.MaxOvershoot = 0
+	pacingStats.MissedFrames = 0
+}
+
 //DT is frame deltatime in seconds
 func DT() float32 {
 	return dt
@@ -61,3 +157,54 @@ func GetAvgFPS() float32 {
 func ElapsedTime() uint64 {
 	return uint64(time.Since(startTime).Seconds())
 }
+
+//FixedDT is the time in seconds simulated by each fixed step
+func FixedDT() float32 {
+	return fixedDT
+}
+
+//SetFixedDT sets the time in seconds simulated by each fixed step. Defaults to 1/60
+func SetFixedDT(seconds float32) {
+	assert.T(seconds > 0, "Fixed DT must be more than zero, but got %f", seconds)
+	fixedDT = seconds
+}
+
+//MaxFixedStepsPerFrame is the most fixed steps that will be run in one frame
+func MaxFixedStepsPerFrame() int {
+	return maxFixedStepsPerFrame
+}
+
+//SetMaxFixedStepsPerFrame limits the fixed steps run in one frame, so that a slow frame
+//doesn't cause more steps the next frame, which makes it slower still (i.e. the 'spiral of death').
+//When the limit is hit the remaining time is dropped and the simulation falls behind real time. Defaults to 8
+func SetMaxFixedStepsPerFrame(maxSteps int) {
+	assert.T(maxSteps > 0, "Max fixed steps per frame must be more than zero, but got %d", maxSteps)
+	maxFixedStepsPerFrame = maxSteps
+}
+
+//FixedStepsThisFrame adds the last frame's DT to the fixed step accumulator and returns how many
+//fixed steps should be run this frame. This also updates the interpolation alpha.
+//This is called by the engine once per frame
+func FixedStepsThisFrame() int {
+
+	fixedDTAccum += dt
+
+	steps := int(fixedDTAccum / fixedDT)
+	if steps > maxFixedStepsPerFrame {
+		steps = maxFixedStepsPerFrame
+
+		// Drop the time we can't catch up on, but keep the fraction so alpha stays meaningful
+		fixedDTAccum = float32(math.Mod(float64(fixedDTAccum), float64(fixedDT)))
+	} else {
+		fixedDTAccum -= float32(steps) * fixedDT
+	}
+
+	interpolationAlpha = fixedDTAccum / fixedDT
+	return steps
+}
+
+//InterpolationAlpha is in the range [0, 1) and is how far the current time is between the last fixed step and the next one.
+//Rendering can use it to interpolate between the last two simulated states for smooth motion, like: lerp(prevState, currState, alpha)
+func InterpolationAlpha() float32 {
+	return interpolationAlpha
+}
@@ -9,6 +9,12 @@ import (
 	"github.com/veandco/go-sdl2/sdl"
 )
 
+var (
+	// Presses consumed by ProcessEvent, so that their releases are also consumed
+	consumedKeyPresses      = make(map[sdl.Scancode]struct{})
+	consumedMouseBtnPresses = make(map[uint8]struct{})
+)
+
 type ImguiInfo struct {
 	ImCtx imgui.Context
 
@@ -33,6 +39,108 @@ func (i *ImguiInfo) FrameStart(winWidth, winHeight float32) {
 	imgui.NewFrame()
 }
 
+// ProcessEvent passes the event to imgui, and returns true (i.e. consumes the event) if imgui wants it for itself.
+// Keyboard and text events are consumed when imgui wants to capture the keyboard, and mouse events when imgui wants to capture the mouse.
+//
+// A release is only consumed if its press was, so keys and buttons pressed before imgui captured input don't stay held for gameplay
+func (i *ImguiInfo) ProcessEvent(event sdl.Event) bool {
+
+	imIo := imgui.CurrentIO()
+
+	switch e := event.(type) {
+
+	case *sdl.MouseWheelEvent:
+
+		imIo.AddMouseWheelDelta(float32(e.X), float32(e.Y))
+		return imIo.WantCaptureMouse()
+
+	case *sdl.KeyboardEvent:
+
+		isDown := e.Type == sdl.KEYDOWN
+		imIo.AddKeyEvent(SdlScancodeToImGuiKey(e.Keysym.Scancode), isDown)
+
+		// Send modifier key updates to imgui
+		if e.Keysym.Sym == sdl.K_LCTRL || e.Keysym.Sym == sdl.K_RCTRL {
+			imIo.SetKeyCtrl(isDown)
+		}
+
+		if e.Keysym.Sym == sdl.K_LSHIFT || e.Keysym.Sym == sdl.K_RSHIFT {
+			imIo.SetKeyShift(isDown)
+		}
+
+		if e.Keysym.Sym == sdl.K_LALT || e.Keysym.Sym == sdl.K_RALT {
+			imIo.SetKeyAlt(isDown)
+		}
+
+		if e.Keysym.Sym == sdl.K_LGUI || e.Keysym.Sym == sdl.K_RGUI {
+			imIo.SetKeySuper(isDown)
+		}
+
+		if !isDown {
+			_, wasConsumed := consumedKeyPresses[e.Keysym.Scancode]
+			delete(consumedKeyPresses, e.Keysym.Scancode)
+			return wasConsumed
+		}
+
+		if imIo.WantCaptureKeyboard() {
+			consumedKeyPresses[e.Keysym.Scancode] = struct{}{}
+			return true
+		}
+
+		return false
+
+	case *sdl.TextInputEvent:
+
+		imIo.AddInputCharactersUTF8(e.GetText())
+		return imIo.WantCaptureKeyboard()
+
+	case *sdl.MouseButtonEvent:
+
+		isDown := e.Type == sdl.MOUSEBUTTONDOWN
+		if imBtn, ok := sdlMouseBtnToImGuiBtn(e.Button); ok {
+			imIo.AddMouseButtonEvent(imBtn, isDown)
+		}
+
+		if !isDown {
+			_, wasConsumed := consumedMouseBtnPresses[e.Button]
+			delete(consumedMouseBtnPresses, e.Button)
+			return wasConsumed
+		}
+
+		if imIo.WantCaptureMouse() {
+			consumedMouseBtnPresses[e.Button] = struct{}{}
+			return true
+		}
+
+		return false
+
+	case *sdl.MouseMotionEvent:
+
+		imIo.AddMousePosEvent(float32(e.X), float32(e.Y))
+		return imIo.WantCaptureMouse()
+	}
+
+	return false
+}
+
+func sdlMouseBtnToImGuiBtn(btn uint8) (int32, bool) {
+
+	switch btn {
+	case sdl.BUTTON_LEFT:
+		return 0, true
+	case sdl.BUTTON_RIGHT:
+		return 1, true
+	case sdl.BUTTON_MIDDLE:
+		return 2, true
+	case sdl.BUTTON_X1:
+		return 3, true
+	case sdl.BUTTON_X2:
+		return 4, true
+	}
+
+	return 0, false
+}
+
 func (i *ImguiInfo) Render(winWidth, winHeight float32, fbWidth, fbHeight int32) {
 
 	// if err := i.ImCtx.SetCurrent(); err != nil {